@@ -0,0 +1,2779 @@
+// Package generator builds the website in content/ using the themes in themes/.
+package generator
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"encoding/csv"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"regexp"
+	"runtime"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+type website struct {
+	configuration map[string]interface{}
+	data          map[string]interface{}
+	environment   string
+	destination   string
+	theme         string
+	themes        []string
+	timezone      *time.Location
+	language      string
+	prefix        string
+	base          string
+	root          string
+	log           io.Writer
+	pool          *pool
+	documents     *documents
+	functions     map[string]interface{}
+	hooks         []Hook
+	files         map[string][]byte
+	cache         map[string]*entry
+	mutex         *sync.Mutex
+	manifest      *manifest
+	record        *dependencies
+}
+
+type entry struct {
+	item         map[string]interface{}
+	err          error
+	dependencies *dependencies
+}
+
+var entityMap = strings.NewReplacer(
+	`&`, "&amp;", `<`, "&lt;", `>`, "&gt;", `"`, "&quot;", `'`, "&#39;", `/`, "&#x2F;", "`", "&#x60;", `=`, "&#x3D;",
+)
+
+func resolve(root string, file string) string {
+	if len(root) == 0 || path.IsAbs(file) {
+		return file
+	}
+	return path.Join(root, file)
+}
+
+func (site *website) loadTheme(name string) map[string]interface{} {
+	config := make(map[string]interface{})
+	if data, err := os.ReadFile(resolve(site.root, "themes/"+name+"/theme.json")); err == nil {
+		if err := json.Unmarshal(data, &config); err != nil {
+			fmt.Fprintln(site.log, "themes/"+name+"/theme.json: "+err.Error())
+		}
+	}
+	return config
+}
+
+func (site *website) themePath(name string) string {
+	for _, item := range site.themes {
+		site.depend("themes/" + item + "/theme.json")
+		file := "themes/" + item + "/" + name
+		if site.exists(file) {
+			return file
+		}
+	}
+	return "themes/" + site.theme + "/" + name
+}
+
+func escapeHTML(text string) string {
+	return entityMap.Replace(text)
+}
+
+func merge(maps ...map[string]interface{}) map[string]interface{} {
+	target := make(map[string]interface{})
+	for _, obj := range maps {
+		for key, value := range obj {
+			target[key] = value
+		}
+	}
+	return target
+}
+
+var sectionRegex = regexp.MustCompile("{{#\\s*([-_\\/\\.\\w]+)\\s*}}\\s?")
+var partialRegex = regexp.MustCompile("{{>\\s*([-_/.\\w]+)\\s*}}")
+var replaceRegex = regexp.MustCompile("{{{\\s*([-_/.\\w]+)\\s*}}}")
+var escapeRegex = regexp.MustCompile("{{\\s*([-_/.\\w]+)\\s*}}")
+
+func mustache(template string, view map[string]interface{}, partials func(string) string) string {
+	for index := 0; index < len(template); {
+		if match := sectionRegex.FindStringIndex(template[index:]); match != nil {
+			name := sectionRegex.FindStringSubmatch(template[index+match[0] : index+match[1]])[1]
+			start := index + match[0]
+			index += match[1]
+			if match := regexp.MustCompile("{{\\/\\s*" + name + "\\s*}}\\s?").FindStringIndex(template[index:]); match != nil {
+				content := template[index : index+match[0]]
+				if value, ok := view[name]; ok {
+					if load, ok := value.(func() []interface{}); ok {
+						value = load()
+					}
+					switch value := value.(type) {
+					case []interface{}:
+						output := make([]string, len(value))
+						for index, item := range value {
+							context, ok := item.(map[string]interface{})
+							if !ok {
+								context = map[string]interface{}{".": item}
+							}
+							output[index] = mustache(content, merge(view, context), partials)
+						}
+						content = strings.Join(output, "")
+					case map[string]interface{}:
+						content = mustache(content, merge(view, value), partials)
+					case Function:
+						content = value(mustache(content, view, partials))
+					case bool:
+						if !value {
+							content = ""
+						}
+					case string:
+						if value == "" {
+							content = ""
+						}
+					}
+				} else {
+					content = ""
+				}
+				template = template[0:start] + content + template[index+match[1]:]
+				index = start
+			}
+		} else {
+			index = len(template)
+		}
+	}
+	template = partialRegex.ReplaceAllStringFunc(template, func(match string) string {
+		name := partialRegex.FindStringSubmatch(match)[1]
+		return mustache(partials(name), view, partials)
+	})
+	template = replaceRegex.ReplaceAllStringFunc(template, func(match string) string {
+		name := replaceRegex.FindStringSubmatch(match)[1]
+		if value, ok := view[name]; ok {
+			switch value := value.(type) {
+			case func() string:
+				return mustache(value(), view, partials)
+			case Function:
+				return value("")
+			case string:
+				return mustache(value, view, partials)
+			case float64, bool:
+				return fmt.Sprint(value)
+			}
+		}
+		return match
+	})
+	template = escapeRegex.ReplaceAllStringFunc(template, func(match string) string {
+		name := escapeRegex.FindStringSubmatch(match)[1]
+		if value, ok := view[name]; ok {
+			switch value := value.(type) {
+			case func() string:
+				return escapeHTML(value())
+			case Function:
+				return escapeHTML(value(""))
+			case string:
+				return escapeHTML(value)
+			case float64, bool:
+				return fmt.Sprint(value)
+			}
+		}
+		return match
+	})
+	return template
+}
+
+func (site *website) host(request *http.Request) string {
+	if host, ok := site.configuration["host"]; ok {
+		return host.(string)
+	}
+	scheme := "http"
+	if value := request.Header.Get("x-forwarded-proto"); len(value) > 0 {
+		scheme = value
+	}
+	if value := request.Header.Get("x-forwarded-protocol"); len(value) > 0 {
+		scheme = value
+	}
+	return scheme + "://" + request.Host
+}
+
+var dateFormats = []string{
+	"2006-01-02 15:04:05 -07:00", time.RFC3339, "2006-01-02T15:04:05", "2006-01-02 15:04:05", "2006-01-02 15:04", "2006-01-02",
+}
+
+var dateNames = map[string][4]string{
+	"de": {
+		"Januar Februar März April Mai Juni Juli August September Oktober November Dezember",
+		"Jan Feb Mär Apr Mai Jun Jul Aug Sep Okt Nov Dez",
+		"Sonntag Montag Dienstag Mittwoch Donnerstag Freitag Samstag",
+		"So Mo Di Mi Do Fr Sa",
+	},
+	"es": {
+		"enero febrero marzo abril mayo junio julio agosto septiembre octubre noviembre diciembre",
+		"ene feb mar abr may jun jul ago sept oct nov dic",
+		"domingo lunes martes miércoles jueves viernes sábado",
+		"dom lun mar mié jue vie sáb",
+	},
+	"fr": {
+		"janvier février mars avril mai juin juillet août septembre octobre novembre décembre",
+		"janv. févr. mars avr. mai juin juil. août sept. oct. nov. déc.",
+		"dimanche lundi mardi mercredi jeudi vendredi samedi",
+		"dim. lun. mar. mer. jeu. ven. sam.",
+	},
+	"it": {
+		"gennaio febbraio marzo aprile maggio giugno luglio agosto settembre ottobre novembre dicembre",
+		"gen feb mar apr mag giu lug ago set ott nov dic",
+		"domenica lunedì martedì mercoledì giovedì venerdì sabato",
+		"dom lun mar mer gio ven sab",
+	},
+	"nl": {
+		"januari februari maart april mei juni juli augustus september oktober november december",
+		"jan feb mrt apr mei jun jul aug sep okt nov dec",
+		"zondag maandag dinsdag woensdag donderdag vrijdag zaterdag",
+		"zo ma di wo do vr za",
+	},
+	"pt": {
+		"janeiro fevereiro março abril maio junho julho agosto setembro outubro novembro dezembro",
+		"jan fev mar abr mai jun jul ago set out nov dez",
+		"domingo segunda-feira terça-feira quarta-feira quinta-feira sexta-feira sábado",
+		"dom seg ter qua qui sex sáb",
+	},
+}
+
+func parseDate(value string, location *time.Location) (time.Time, error) {
+	value = strings.TrimSpace(value)
+	for _, format := range dateFormats {
+		if date, err := time.ParseInLocation(format, value, location); err == nil {
+			return date, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("invalid date '%s'", value)
+}
+
+func localizeDate(text string, language string) string {
+	names, ok := dateNames[language]
+	if !ok {
+		return text
+	}
+	months := strings.Fields(names[0])
+	shortMonths := strings.Fields(names[1])
+	days := strings.Fields(names[2])
+	shortDays := strings.Fields(names[3])
+	pairs := []string{}
+	for index := 0; index < 12; index++ {
+		pairs = append(pairs, time.Month(index+1).String(), months[index])
+	}
+	for index := 0; index < 7; index++ {
+		pairs = append(pairs, time.Weekday(index).String(), days[index])
+	}
+	for index := 0; index < 12; index++ {
+		pairs = append(pairs, time.Month(index + 1).String()[0:3], shortMonths[index])
+	}
+	for index := 0; index < 7; index++ {
+		pairs = append(pairs, time.Weekday(index).String()[0:3], shortDays[index])
+	}
+	return strings.NewReplacer(pairs...).Replace(text)
+}
+
+func (site *website) location() *time.Location {
+	site.option("timezone")
+	return site.timezone
+}
+
+func (site *website) parseDate(value string) (time.Time, error) {
+	if location := site.location(); location != nil {
+		return parseDate(value, location)
+	}
+	return parseDate(value, time.UTC)
+}
+
+func (site *website) formatDate(date time.Time, format string) string {
+	switch format {
+	case "atom":
+		return date.UTC().Format("2006-01-02T15:04:05Z")
+	case "rss":
+		return date.UTC().Format("Mon, 02 Jan 2006 15:04:05 +0000")
+	case "user":
+		layout := "Jan 2, 2006"
+		if value, ok := site.option("dateFormat").(string); ok && len(value) > 0 {
+			layout = value
+		}
+		if location := site.location(); location != nil {
+			date = date.In(location)
+		}
+		return localizeDate(date.Format(layout), site.language)
+	}
+	return ""
+}
+
+var tagRegexp = regexp.MustCompile("<(\\w+)[^>]*>")
+var entityRegexp = regexp.MustCompile("(#?[A-Za-z0-9]+;)")
+var truncateMap = map[string]bool{
+	"pre": true, "code": true, "img": true, "table": true, "style": true, "script": true, "h2": true, "h3": true,
+}
+
+func truncate(text string, length int) string {
+	closeTags := make(map[int]string)
+	ellipsis := ""
+	count := 0
+	index := 0
+	for count < length && index < len(text) {
+		if text[index] == '<' {
+			if closeTag, ok := closeTags[index]; ok {
+				delete(closeTags, index)
+				index += len(closeTag)
+			} else {
+				match := tagRegexp.FindStringSubmatch(text[index:])
+				if len(match) > 0 {
+					tag := strings.ToLower(match[1])
+					if value, ok := truncateMap[tag]; ok && value {
+						break
+					}
+					index += len(match[0])
+					if match := regexp.MustCompile("(?i)</" + tag + "\\s*>").FindStringIndex(text[index:]); match != nil {
+						closeTags[index+match[0]] = "</" + tag + ">"
+					}
+				} else {
+					index++
+					count++
+				}
+			}
+		} else if text[index] == '&' {
+			index++
+			if entity := entityRegexp.FindString(text[index:]); len(entity) > 0 {
+				index += len(entity)
+			}
+			count++
+		} else {
+			if text[index] == ' ' {
+				index++
+				count++
+			}
+			skip := strings.IndexAny(text[index:], " <&")
+			if skip == -1 {
+				skip = len(text) - index
+			}
+			if count+skip >= length {
+				ellipsis = "&hellip;"
+			}
+			if count+skip-15 > length {
+				skip = length - count
+			}
+			index += skip
+			count += skip
+		}
+	}
+	output := []string{}
+	output = append(output, text[0:index])
+	if len(ellipsis) > 0 {
+		output = append(output, ellipsis)
+	}
+	keys := []int{}
+	for key := range closeTags {
+		keys = append(keys, key)
+	}
+	sort.Sort(sort.IntSlice(keys))
+	for _, key := range keys {
+		if closeTag, ok := closeTags[key]; ok {
+			output = append(output, closeTag)
+		}
+	}
+	return strings.Join(output, "")
+}
+
+var moreRegexp = regexp.MustCompile("<!--\\s*more\\s*-->")
+var stripRegexp = regexp.MustCompile("<[^>]*>")
+
+func (site *website) excerpt(item map[string]interface{}) (string, bool) {
+	if summary, ok := item["summary"].(string); ok && len(summary) > 0 {
+		return markdown(summary), true
+	}
+	content := item["content"].(string)
+	if match := moreRegexp.FindStringIndex(content); match != nil {
+		return strings.TrimSpace(content[0:match[0]]), true
+	}
+	length := 250
+	if value, ok := site.option("truncate").(float64); ok && value > 0 {
+		length = int(value)
+	}
+	content = regexp.MustCompile("\\s\\s").ReplaceAllString(content, " ")
+	truncated := truncate(content, length)
+	return truncated, truncated != content
+}
+
+func plainText(text string) string {
+	text = stripRegexp.ReplaceAllString(text, " ")
+	return strings.Join(strings.Fields(html.UnescapeString(text)), " ")
+}
+
+func (site *website) posts() []string {
+	folders := []string{}
+	items := site.readDir("content/blog/")
+	for i := len(items) - 1; i >= 0; i-- {
+		item := items[i]
+		if item.IsDir() && site.translated("content/blog/"+item.Name()+"/index.md") {
+			folders = append(folders, item.Name())
+		}
+	}
+	return folders
+}
+
+func (site *website) languages() []map[string]interface{} {
+	languages := []map[string]interface{}{}
+	if items, ok := site.option("languages").([]interface{}); ok {
+		for _, item := range items {
+			if language, ok := item.(map[string]interface{}); ok {
+				if code, ok := language["code"].(string); ok && len(code) > 0 {
+					languages = append(languages, language)
+				}
+			}
+		}
+	}
+	return languages
+}
+
+func (site *website) localized(file string) string {
+	if len(site.prefix) > 0 {
+		extension := path.Ext(file)
+		translation := strings.TrimSuffix(file, extension) + "." + site.language + extension
+		if site.exists(translation) {
+			return translation
+		}
+	}
+	return file
+}
+
+func (site *website) translated(file string) bool {
+	if !site.exists(file) {
+		return false
+	}
+	return len(site.prefix) == 0 || site.localized(file) != file
+}
+
+func (site *website) localize(name string) (string, bool) {
+	extension := path.Ext(name)
+	base := strings.TrimSuffix(name, extension)
+	if code := strings.TrimPrefix(path.Ext(base), "."); len(code) > 0 {
+		for _, language := range site.languages() {
+			if language["code"] == code {
+				return strings.TrimSuffix(base, "."+code) + extension, len(site.prefix) > 0 && code == site.language
+			}
+		}
+	}
+	return name, true
+}
+
+var htmlBlockTags = []string{"<style", "<script", "<svg", "<p"}
+
+func markdown(s string) string {
+	lines := strings.Split(s, "\n")
+	var out []string
+	var para []string
+	var codeLines []string
+	inCode := false
+	inHTML := ""
+	flushPara := func() {
+		if len(para) == 0 {
+			return
+		}
+		text := strings.Join(para, "\n")
+		text = inlineMarkdown(text)
+		out = append(out, "<p>"+text+"</p>")
+		para = nil
+	}
+	for _, line := range lines {
+		if inHTML != "" {
+			out = append(out, line)
+			if strings.Contains(line, "</"+inHTML+">") || strings.Contains(line, "<"+inHTML+"/>") || strings.Contains(line, "<"+inHTML+" />") {
+				inHTML = ""
+			}
+			continue
+		}
+		if strings.HasPrefix(line, "```") {
+			if !inCode {
+				flushPara()
+				inCode = true
+				codeLines = nil
+			} else {
+				inCode = false
+				code := strings.Join(codeLines, "\n")
+				code = mdBold.ReplaceAllString(code, `<b>$1</b>`)
+				out = append(out, "<pre>"+code+"</pre>")
+			}
+			continue
+		}
+		if inCode {
+			codeLines = append(codeLines, line)
+			continue
+		}
+		trimmed := strings.TrimSpace(line)
+		if trimmed == "" {
+			flushPara()
+			continue
+		}
+		if strings.HasPrefix(trimmed, "<") {
+			flushPara()
+			for _, tag := range htmlBlockTags {
+				if strings.HasPrefix(strings.ToLower(trimmed), tag) {
+					name := tag[1:]
+					if !strings.Contains(line, "</"+name+">") && !strings.Contains(line, "<"+name+"/>") && !strings.Contains(line, "<"+name+" />") {
+						inHTML = name
+					}
+					break
+				}
+			}
+			out = append(out, line)
+			continue
+		}
+		if strings.HasPrefix(trimmed, "### ") {
+			flushPara()
+			out = append(out, "<h3>"+inlineMarkdown(strings.TrimPrefix(trimmed, "### "))+"</h3>")
+			continue
+		}
+		if strings.HasPrefix(trimmed, "## ") {
+			flushPara()
+			out = append(out, "<h2>"+inlineMarkdown(strings.TrimPrefix(trimmed, "## "))+"</h2>")
+			continue
+		}
+		para = append(para, line)
+	}
+	flushPara()
+	return strings.Join(out, "\n")
+}
+
+var mdImage = regexp.MustCompile(`!\[([^\]]*)\]\(([^)]+)\)`)
+var mdLink = regexp.MustCompile(`\[([^\]]+)\]\(([^)]+)\)`)
+var mdBold = regexp.MustCompile(`\*\*(.+?)\*\*`)
+var mdItalic = regexp.MustCompile(`(?:^|[^*])\*([^*]+?)\*(?:[^*]|$)`)
+var mdCode = regexp.MustCompile("`([^`]+)`")
+
+func inlineMarkdown(s string) string {
+	// Code first to protect from other replacements
+	var codes []string
+	s = mdCode.ReplaceAllStringFunc(s, func(m string) string {
+		code := mdCode.FindStringSubmatch(m)[1]
+		placeholder := fmt.Sprintf("\x00CODE%d\x00", len(codes))
+		codes = append(codes, "<code>"+escapeHTML(code)+"</code>")
+		return placeholder
+	})
+	s = mdImage.ReplaceAllString(s, `<img alt="$1" src="$2">`)
+	s = mdLink.ReplaceAllString(s, `<a href="$2">$1</a>`)
+	s = mdBold.ReplaceAllString(s, `<b>$1</b>`)
+	s = mdItalic.ReplaceAllStringFunc(s, func(m string) string {
+		sub := mdItalic.FindStringSubmatch(m)
+		prefix := ""
+		suffix := ""
+		if len(m) > 0 && m[0] != '*' {
+			prefix = string(m[0])
+		}
+		if len(m) > 0 && m[len(m)-1] != '*' {
+			suffix = string(m[len(m)-1])
+		}
+		return prefix + "<i>" + sub[1] + "</i>" + suffix
+	})
+	// Restore code placeholders
+	for i, code := range codes {
+		s = strings.Replace(s, fmt.Sprintf("\x00CODE%d\x00", i), code, 1)
+	}
+	return s
+}
+
+var datePrefixRegexp = regexp.MustCompile("^(\\d{4})-(\\d{2})-(\\d{2})(-|$)")
+
+func (site *website) permalink(folder string, item map[string]interface{}) string {
+	pattern := "/blog/:folder/"
+	if value, ok := site.option("permalink").(string); ok && len(value) > 0 {
+		pattern = value
+	}
+	return expandPermalink(pattern, folder, item)
+}
+
+func expandPermalink(pattern string, folder string, item map[string]interface{}) string {
+	slug, _ := item["slug"].(string)
+	if len(slug) == 0 {
+		slug = datePrefixRegexp.ReplaceAllString(folder, "")
+	}
+	if len(slug) == 0 {
+		slug = folder
+	}
+	year, month, day := "", "", ""
+	if value, ok := item["date"].(string); ok {
+		if date, err := parseDate(value, time.UTC); err == nil {
+			year, month, day = date.Format("2006"), date.Format("01"), date.Format("02")
+		}
+	}
+	replacer := strings.NewReplacer(":folder", folder, ":slug", slug, ":year", year, ":month", month, ":day", day)
+	location := strings.TrimPrefix(path.Clean("/"+replacer.Replace(pattern)), "/")
+	if len(location) == 0 {
+		return ""
+	}
+	return location + "/"
+}
+
+func (site *website) postLocation(source string) (string, bool) {
+	if strings.HasPrefix(source, "content/blog/") && strings.Count(source, "/") == 3 {
+		if item, _ := site.loadPost(site.localized(source + "index.md")); item != nil {
+			return site.permalink(path.Base(source), item), true
+		}
+	}
+	if name, collection := site.collectionOf(source); len(name) > 0 {
+		if item, _ := site.loadPost(source + "index.md"); item != nil {
+			return expandPermalink(collection["permalink"].(string), path.Base(source), item), true
+		}
+	}
+	return "", false
+}
+
+func (site *website) collection(name string) map[string]interface{} {
+	collections, _ := site.option("collections").(map[string]interface{})
+	config, ok := collections[name].(map[string]interface{})
+	if !ok {
+		return nil
+	}
+	collection := merge(map[string]interface{}{
+		"folder":   name,
+		"sort":     "date",
+		"layout":   "page",
+		"template": "list.html",
+	}, config)
+	if _, ok := collection["permalink"]; !ok {
+		collection["permalink"] = "/" + collection["folder"].(string) + "/:folder/"
+	}
+	if _, ok := collection["order"]; !ok {
+		collection["order"] = "ascending"
+		if collection["sort"] == "date" {
+			collection["order"] = "descending"
+		}
+	}
+	return collection
+}
+
+func (site *website) collectionOf(source string) (string, map[string]interface{}) {
+	collections, _ := site.option("collections").(map[string]interface{})
+	for name := range collections {
+		if collection := site.collection(name); collection != nil {
+			folder := "content/" + collection["folder"].(string) + "/"
+			if strings.HasPrefix(source, folder) && strings.Count(strings.TrimPrefix(source, folder), "/") == 1 {
+				return name, collection
+			}
+		}
+	}
+	return "", nil
+}
+
+func compareValues(a interface{}, b interface{}) int {
+	x, _ := a.(string)
+	y, _ := b.(string)
+	if i, err := strconv.ParseFloat(x, 64); err == nil {
+		if j, err := strconv.ParseFloat(y, 64); err == nil {
+			if i < j {
+				return -1
+			} else if i > j {
+				return 1
+			}
+			return 0
+		}
+	}
+	if i, err := parseDate(x, time.UTC); err == nil {
+		if j, err := parseDate(y, time.UTC); err == nil {
+			return i.Compare(j)
+		}
+	}
+	return strings.Compare(x, y)
+}
+
+func (site *website) loadCollection(name string, root string) []interface{} {
+	collection := site.collection(name)
+	folder := "content/" + collection["folder"].(string) + "/"
+	entries := []map[string]interface{}{}
+	items := site.readDir(folder)
+	for _, item := range items {
+		if item.IsDir() && !strings.HasPrefix(item.Name(), ".") {
+			entry, _ := site.loadPost(folder + item.Name() + "/index.md")
+			if entry != nil && (entry["state"] != "draft" || site.environment != "production") {
+				entry["url"] = root + expandPermalink(collection["permalink"].(string), item.Name(), entry)
+				if image, ok := entry["image"].(string); ok && !schemeRegexp.MatchString(image) && !strings.HasPrefix(image, "/") {
+					entry["image"] = entry["url"].(string) + image
+				}
+				entry["excerpt"], entry["more"] = site.excerpt(entry)
+				entries = append(entries, entry)
+			}
+		}
+	}
+	key := collection["sort"].(string)
+	descending := collection["order"] == "descending"
+	sort.SliceStable(entries, func(i int, j int) bool {
+		if descending {
+			return compareValues(entries[i][key], entries[j][key]) > 0
+		}
+		return compareValues(entries[i][key], entries[j][key]) < 0
+	})
+	output := make([]interface{}, len(entries))
+	for index, entry := range entries {
+		if value, ok := entry["date"].(string); ok {
+			if date, err := site.parseDate(value); err == nil {
+				entry["date"] = site.formatDate(date, "user")
+			}
+		}
+		output[index] = entry
+	}
+	return output
+}
+
+func (site *website) collectionsView(view map[string]interface{}, root string, partials func(string) string) {
+	collections, _ := site.option("collections").(map[string]interface{})
+	for name := range collections {
+		if collection := site.collection(name); collection != nil {
+			if _, ok := view[name]; ok {
+				fmt.Fprintln(site.log, "Collection '"+name+"' conflicts with an existing variable.")
+				continue
+			}
+			var items []interface{}
+			load := func() []interface{} {
+				if items == nil {
+					items = site.loadCollection(name, root)
+				}
+				return items
+			}
+			view[name] = load
+			view[name+".list"] = func() string {
+				return mustache(partials(collection["template"].(string)), merge(view, map[string]interface{}{"items": load()}), partials)
+			}
+		}
+	}
+}
+
+var shortcodeRegexp = regexp.MustCompile(`{{<\s*(/?)([-\w]+)((?:\s+[-\w]+=(?:"[^"]*"|[^\s">]+))*)\s*>}}`)
+var parameterRegexp = regexp.MustCompile(`([-\w]+)=(?:"([^"]*)"|([^\s">]+))`)
+var placeholderRegexp = regexp.MustCompile(`<!--shortcode:(\d+)-->`)
+var variableRegexp = regexp.MustCompile("{{[#^{]?\\s*([-_/.\\w]+)\\s*}}")
+
+func (site *website) shortcodes(text string, blocks *[]string) string {
+	output := []string{}
+	segment := []string{}
+	inCode := false
+	for _, line := range strings.Split(text, "\n") {
+		if strings.HasPrefix(line, "```") {
+			if !inCode {
+				output = append(output, site.expandShortcodes(strings.Join(segment, "\n"), blocks))
+				segment = nil
+			} else {
+				output = append(output, strings.Join(segment, "\n"))
+				segment = nil
+			}
+			output = append(output, line)
+			inCode = !inCode
+			continue
+		}
+		segment = append(segment, line)
+	}
+	if inCode {
+		output = append(output, strings.Join(segment, "\n"))
+	} else {
+		output = append(output, site.expandShortcodes(strings.Join(segment, "\n"), blocks))
+	}
+	return strings.Join(output, "\n")
+}
+
+func (site *website) expandShortcodes(text string, blocks *[]string) string {
+	output := []string{}
+	for {
+		match := shortcodeRegexp.FindStringSubmatchIndex(text)
+		if match == nil {
+			break
+		}
+		output = append(output, text[0:match[0]])
+		tag := text[match[0]:match[1]]
+		name := text[match[4]:match[5]]
+		rest := text[match[1]:]
+		if text[match[2]:match[3]] == "/" {
+			output = append(output, tag)
+			text = rest
+			continue
+		}
+		view := make(map[string]interface{})
+		for _, parameter := range parameterRegexp.FindAllStringSubmatch(text[match[6]:match[7]], -1) {
+			view[parameter[1]] = parameter[2] + parameter[3]
+		}
+		if end := regexp.MustCompile("{{<\\s*/" + regexp.QuoteMeta(name) + "\\s*>}}").FindStringIndex(rest); end != nil {
+			inner := strings.TrimSpace(rest[0:end[0]])
+			view["inner"] = restoreShortcodes(markdown(site.expandShortcodes(inner, blocks)), *blocks)
+			tag += rest[0:end[1]]
+			rest = rest[end[1]:]
+		}
+		text = rest
+		template, err := site.template(site.themePath("shortcodes/" + name + ".html"))
+		if err != nil {
+			fmt.Fprintln(site.log, "Shortcode '"+name+"' not found.")
+			output = append(output, tag)
+			continue
+		}
+		for _, variable := range variableRegexp.FindAllStringSubmatch(string(template), -1) {
+			if _, ok := view[variable[1]]; !ok && variable[1] != "root" {
+				view[variable[1]] = ""
+			}
+		}
+		output = append(output, "<!--shortcode:"+strconv.Itoa(len(*blocks))+"-->")
+		*blocks = append(*blocks, strings.TrimSpace(mustache(string(template), view, nil)))
+	}
+	output = append(output, text)
+	return strings.Join(output, "")
+}
+
+func restoreShortcodes(text string, blocks []string) string {
+	return placeholderRegexp.ReplaceAllStringFunc(text, func(match string) string {
+		index, _ := strconv.Atoi(placeholderRegexp.FindStringSubmatch(match)[1])
+		if index < len(blocks) {
+			return blocks[index]
+		}
+		return match
+	})
+}
+
+type document struct {
+	metadata map[string]interface{}
+	body     string
+}
+
+type documents struct {
+	sync.Mutex
+	items map[string]*document
+	root  string
+	log   io.Writer
+}
+
+func (documents *documents) load(file string) *document {
+	documents.Lock()
+	item, ok := documents.items[file]
+	documents.Unlock()
+	if ok {
+		return item
+	}
+	if stat, err := os.Stat(resolve(documents.root, file)); !os.IsNotExist(err) && !stat.IsDir() {
+		data, err := os.ReadFile(resolve(documents.root, file))
+		if err != nil {
+			fmt.Fprintln(documents.log, err)
+		} else {
+			item = &document{metadata: make(map[string]interface{})}
+			content := []string{}
+			metadata := -1
+			key := ""
+			lines := regexp.MustCompile("\\r\\n?|\\n").Split(string(data), -1)
+			for len(lines) > 0 {
+				line := lines[0]
+				lines = lines[1:]
+				if strings.HasPrefix(line, "---") {
+					metadata++
+				} else if metadata == 0 {
+					trimmed := strings.TrimSpace(line)
+					if list, ok := item.metadata[key].([]string); ok && strings.HasPrefix(trimmed, "- ") {
+						item.metadata[key] = append(list, strings.Trim(strings.TrimSpace(trimmed[2:]), "\""))
+					} else if index := strings.Index(line, ":"); index >= 0 {
+						key = strings.Trim(strings.Trim(line[0:index], " "), "\"")
+						value := strings.Trim(strings.Trim(line[index+1:], " "), "\"")
+						if len(value) == 0 && len(lines) > 0 && strings.HasPrefix(strings.TrimSpace(lines[0]), "- ") {
+							item.metadata[key] = []string{}
+						} else {
+							item.metadata[key] = value
+						}
+					}
+				} else {
+					content = append(content, line)
+				}
+			}
+			item.body = strings.Join(content, "\n")
+		}
+	}
+	documents.Lock()
+	documents.items[file] = item
+	documents.Unlock()
+	return item
+}
+
+func (site *website) loadPost(file string) (map[string]interface{}, error) {
+	site.mutex.Lock()
+	cached, ok := site.cache[file]
+	site.mutex.Unlock()
+	if !ok {
+		cached = &entry{dependencies: newDependencies()}
+		scope := site.track(cached.dependencies)
+		scope.depend(file)
+		if document := site.documents.load(file); document != nil {
+			cached.item, cached.err = scope.parsePost(file, document)
+		}
+		site.mutex.Lock()
+		site.cache[file] = cached
+		site.mutex.Unlock()
+	}
+	site.record.merge(cached.dependencies)
+	if cached.item == nil {
+		return nil, cached.err
+	}
+	return merge(cached.item), nil
+}
+
+func (site *website) parsePost(file string, document *document) (map[string]interface{}, error) {
+	hooks := strings.HasPrefix(file, "content/")
+	page := &Page{Source: file, Metadata: merge(document.metadata), Content: document.body}
+	if hooks {
+		if ok, err := site.hook(page, func(hook Hook) error {
+			if hook, ok := hook.(FrontMatterHook); ok {
+				return hook.FrontMatter(page)
+			}
+			return nil
+		}); !ok {
+			return nil, err
+		}
+	}
+	site.variables(page.Content)
+	if strings.HasSuffix(file, ".md") {
+		blocks := []string{}
+		page.Content = restoreShortcodes(markdown(site.shortcodes(page.Content, &blocks)), blocks)
+		if hooks {
+			if ok, err := site.hook(page, func(hook Hook) error {
+				if hook, ok := hook.(MarkdownHook); ok {
+					return hook.Markdown(page)
+				}
+				return nil
+			}); !ok {
+				return nil, err
+			}
+		}
+	}
+	item := page.Metadata
+	item["content"] = page.Content
+	if _, ok := item["date"]; !ok {
+		if match := datePrefixRegexp.FindStringSubmatch(path.Base(path.Dir(file))); match != nil {
+			item["date"] = match[1] + "-" + match[2] + "-" + match[3]
+		}
+	}
+	for _, key := range []string{"date", "updated"} {
+		if value, ok := item[key].(string); ok {
+			if _, err := site.parseDate(value); err != nil {
+				fmt.Fprintln(site.log, "Warning: "+file+": "+key+": "+err.Error())
+			}
+		}
+	}
+	return item, nil
+}
+
+func (site *website) loadPosts() {
+	files := []string{}
+	for _, folder := range site.posts() {
+		files = append(files, site.localized("content/blog/"+folder+"/index.md"))
+	}
+	collections, _ := site.option("collections").(map[string]interface{})
+	for name := range collections {
+		if collection := site.collection(name); collection != nil {
+			folder := "content/" + collection["folder"].(string) + "/"
+			items, _ := os.ReadDir(resolve(site.root, folder))
+			for _, item := range items {
+				if item.IsDir() && !strings.HasPrefix(item.Name(), ".") {
+					files = append(files, folder+item.Name()+"/index.md")
+				}
+			}
+		}
+	}
+	site.pool.run(len(files), func(index int) {
+		site.loadPost(files[index])
+	})
+}
+
+func (site *website) renderBlog(folders []string, destination string, root string, page int) (string, error) {
+	items := make([]interface{}, 0)
+	view := make(map[string]interface{})
+	count := 10
+	if value, ok := site.option("pagination").(float64); ok && value > 0 {
+		count = int(value)
+	}
+	for count > 0 && len(folders) > 0 {
+		folder := folders[0]
+		folders = folders[1:]
+		item, _ := site.loadPost(site.localized("content/blog/" + folder + "/index.md"))
+		if item != nil && (item["state"] == "post" || site.environment != "production") {
+			item["url"] = site.permalink(folder, item)
+			if _, ok := item["date"]; ok {
+				if date, e := site.parseDate(item["date"].(string)); e == nil {
+					item["date"] = site.formatDate(date, "user")
+				}
+			}
+			content, more := site.excerpt(item)
+			item["content"] = content
+			item["more"] = more
+			items = append(items, item)
+			count--
+		}
+	}
+	view["items"] = items
+	placeholder := make([]interface{}, 0)
+	if len(folders) > 0 {
+		page++
+		location := "blog/page" + strconv.Itoa(page) + ".html"
+		placeholder = append(placeholder, map[string]interface{}{"url": root + "../" + location})
+		file := destination + "/" + location
+		data, err := site.renderBlog(folders, destination, root, page)
+		if err != nil {
+			return "", err
+		}
+		if err := site.output(&Page{Source: site.themePath("feed.html"), Destination: file}, data); err != nil {
+			return "", err
+		}
+	}
+	view["placeholder"] = placeholder
+	view["root"] = root
+	template, err := site.template(site.themePath("feed.html"))
+	if err != nil {
+		fmt.Fprintln(site.log, err)
+		return "", nil
+	}
+	return mustache(string(template), view, nil), nil
+}
+
+var imageRegexp = regexp.MustCompile("<img[^>]*\\ssrc=\"([^\"]*)\"")
+var schemeRegexp = regexp.MustCompile("^([a-zA-Z][-+.a-zA-Z0-9]*:|//)")
+
+func (site *website) absoluteURL(base string, location string) string {
+	if schemeRegexp.MatchString(location) {
+		return location
+	}
+	if strings.HasPrefix(location, "/") {
+		host, _ := site.option("host").(string)
+		return host + location
+	}
+	return base + location
+}
+
+func (site *website) seo(item map[string]interface{}, url string, published string, modified string) string {
+	title, _ := item["title"].(string)
+	description, _ := item["description"].(string)
+	author, _ := item["author"].(string)
+	image, _ := item["image"].(string)
+	if len(image) == 0 {
+		if match := imageRegexp.FindStringSubmatch(item["content"].(string)); match != nil {
+			image = html.UnescapeString(match[1])
+		}
+	}
+	if len(image) > 0 {
+		image = site.absoluteURL(url, image)
+	}
+	lines := []string{}
+	if len(url) > 0 {
+		lines = append(lines, "<link rel=\"canonical\" href=\""+html.EscapeString(url)+"\" />")
+	}
+	meta := func(attribute string, name string, content string) {
+		if len(content) > 0 {
+			lines = append(lines, "<meta "+attribute+"=\""+name+"\" content=\""+html.EscapeString(content)+"\" />")
+		}
+	}
+	schema := map[string]interface{}{
+		"@context":    "https://schema.org",
+		"@type":       "BlogPosting",
+		"headline":    title,
+		"description": description,
+		"author":      map[string]interface{}{"@type": "Person", "name": author},
+	}
+	if len(url) > 0 {
+		schema["url"] = url
+		schema["mainEntityOfPage"] = url
+	}
+	name, _ := site.option("name").(string)
+	meta("property", "og:type", "article")
+	meta("property", "og:site_name", name)
+	meta("property", "og:title", title)
+	meta("property", "og:description", description)
+	meta("property", "og:url", url)
+	meta("property", "og:image", image)
+	if date, err := site.parseDate(published); err == nil {
+		schema["datePublished"] = site.formatDate(date, "atom")
+		schema["dateModified"] = site.formatDate(date, "atom")
+		meta("property", "article:published_time", site.formatDate(date, "atom"))
+	}
+	if date, err := site.parseDate(modified); err == nil {
+		schema["dateModified"] = site.formatDate(date, "atom")
+		meta("property", "article:modified_time", site.formatDate(date, "atom"))
+	}
+	if len(image) > 0 {
+		schema["image"] = image
+		meta("name", "twitter:card", "summary_large_image")
+	} else {
+		meta("name", "twitter:card", "summary")
+	}
+	meta("name", "twitter:title", title)
+	meta("name", "twitter:description", description)
+	meta("name", "twitter:image", image)
+	data, err := json.Marshal(schema)
+	if err != nil {
+		fmt.Fprintln(site.log, err)
+	} else {
+		lines = append(lines, "<script type=\"application/ld+json\">"+string(data)+"</script>")
+	}
+	return strings.Join(lines, "\n")
+}
+
+func (site *website) renderPost(source string, destination string, root string) (bool, error) {
+	if strings.HasPrefix(source, "content/blog/") && strings.Count(source, "/") == 3 && strings.HasPrefix(path.Base(source), "index.") && strings.HasSuffix(source, ".md") {
+		item, err := site.loadPost(source)
+		if err != nil {
+			return true, err
+		}
+		if item != nil {
+			location := site.permalink(path.Base(path.Dir(source)), item)
+			published, _ := item["date"].(string)
+			modified, _ := item["updated"].(string)
+			if updated, ok := item["updated"]; ok {
+				if date, ok := item["date"]; !ok || date == updated {
+					delete(item, "updated")
+				} else if date, e := site.parseDate(updated.(string)); e == nil {
+					item["updated"] = site.formatDate(date, "user")
+				}
+			}
+			if _, ok := item["date"]; ok {
+				if date, e := site.parseDate(item["date"].(string)); e == nil {
+					item["date"] = site.formatDate(date, "user")
+				}
+			}
+			if _, ok := item["author"]; !ok {
+				item["author"] = site.option("name").(string)
+			}
+			if _, ok := item["description"]; !ok {
+				content, _ := site.excerpt(item)
+				item["description"] = plainText(content)
+			}
+			canonical := ""
+			if host, _ := site.option("host").(string); len(host) > 0 {
+				canonical = host + "/" + location
+				item["canonical"] = canonical
+			}
+			item["seo"] = site.seo(item, canonical, published, modified)
+			view := merge(site.configuration, site.data, site.functions, item)
+			view["root"] = root
+			site.languageView(view, root, location, path.Dir(source)+"/index.md")
+			partials := func(name string) string {
+				data, err := site.template(site.themePath(name))
+				if err != nil {
+					fmt.Fprintln(site.log, err)
+					return ""
+				}
+				return string(data)
+			}
+			site.collectionsView(view, root, partials)
+			page := &Page{Source: source, Destination: destination, Metadata: item, View: view}
+			if ok, err := site.hook(page, func(hook Hook) error {
+				if hook, ok := hook.(TemplateHook); ok {
+					return hook.Template(page)
+				}
+				return nil
+			}); !ok {
+				return true, err
+			}
+			if name, ok := item["layout"].(string); ok && len(name) > 0 {
+				data, err := site.renderLayout(name, page.View, partials)
+				if err == nil {
+					return true, site.output(page, data)
+				}
+				fmt.Fprintln(site.log, source+": "+err.Error())
+			}
+			template, err := site.template(site.themePath("post.html"))
+			if err != nil {
+				fmt.Fprintln(site.log, err)
+			} else {
+				data := mustache(string(template), page.View, partials)
+				return true, site.output(page, data)
+			}
+		}
+	}
+	return false, nil
+}
+
+func (site *website) renderFile(source string, destination string) {
+	data, err := site.readFile(source)
+	if err != nil {
+		fmt.Fprintln(site.log, err)
+		return
+	}
+	site.write(destination, data)
+}
+
+func (site *website) renderFeed(source string, destination string) error {
+	host, _ := site.option("host").(string)
+	format := strings.TrimPrefix(path.Ext(source), ".")
+	count := 10
+	items := make([]interface{}, 0)
+	feed := map[string]interface{}{
+		"name":        site.option("name"),
+		"description": site.option("description"),
+		"author":      site.option("name"),
+		"url":         site.option("feeds").([]interface{})[0].(map[string]interface{})["url"].(string),
+		"host":        host,
+	}
+	recentFound := false
+	recent := time.Now()
+	folders := site.posts()
+	for len(folders) > 0 && count > 0 {
+		folder := folders[0]
+		folders = folders[1:]
+		item, _ := site.loadPost(site.localized("content/blog/" + folder + "/index.md"))
+		if item != nil && (item["state"] == "post" || site.environment != "production") {
+			item["url"] = host + "/" + site.permalink(folder, item)
+			if author, ok := item["author"]; !ok || author.(string) == site.option("name").(string) {
+				item["author"] = false
+			}
+			if _, ok := item["date"]; ok {
+				if date, err := site.parseDate(item["date"].(string)); err == nil {
+					updated := date
+					if _, ok := item["updated"]; ok {
+						if temp, err := site.parseDate(item["updated"].(string)); err == nil {
+							updated = temp
+						}
+					}
+					item["date"] = site.formatDate(date, format)
+					item["updated"] = site.formatDate(updated, format)
+					if !recentFound || recent.Before(updated) {
+						recent = updated
+						recentFound = true
+					}
+				}
+			}
+			item["content"] = escapeHTML(item["content"].(string))
+			items = append(items, item)
+			count--
+		}
+	}
+	feed["updated"] = site.formatDate(recent, format)
+	feed["items"] = items
+	page := &Page{Source: source, Destination: destination, View: feed}
+	if ok, err := site.hook(page, func(hook Hook) error {
+		if hook, ok := hook.(TemplateHook); ok {
+			return hook.Template(page)
+		}
+		return nil
+	}); !ok {
+		return err
+	}
+	template, err := site.template(source)
+	if err != nil {
+		fmt.Fprintln(site.log, err)
+		return nil
+	}
+	data := mustache(template, page.View, nil)
+	return site.output(page, data)
+}
+
+func (site *website) languageView(view map[string]interface{}, root string, location string, source string) {
+	view["languages"] = make([]interface{}, 0)
+	languages := site.languages()
+	if len(languages) < 2 {
+		return
+	}
+	top := root + strings.Repeat("../", strings.Count(site.prefix, "/"))
+	host, _ := site.option("host").(string)
+	host = strings.TrimSuffix(host, "/"+strings.TrimSuffix(site.prefix, "/"))
+	switcher := make([]interface{}, 0)
+	alternates := make([]interface{}, 0)
+	for index, language := range languages {
+		code := language["code"].(string)
+		prefix := ""
+		if index > 0 {
+			prefix = code + "/"
+			extension := path.Ext(source)
+			if len(source) > 0 && !site.exists(strings.TrimSuffix(source, extension)+"."+code+extension) {
+				continue
+			}
+		}
+		label, ok := language["label"].(string)
+		if !ok {
+			label = code
+		}
+		switcher = append(switcher, map[string]interface{}{"code": code, "label": label, "url": top + prefix + location, "active": code == site.language})
+		alternates = append(alternates, map[string]interface{}{"code": code, "url": host + "/" + prefix + location})
+	}
+	if len(switcher) < 2 {
+		return
+	}
+	view["language"] = site.language
+	view["languages"] = switcher
+	view["alternates"] = alternates
+}
+
+func (site *website) renderLayout(name string, view map[string]interface{}, partials func(string) string) (string, error) {
+	content, _ := view["content"].(string)
+	visited := make(map[string]bool)
+	for len(name) > 0 {
+		if visited[name] {
+			return "", fmt.Errorf("layout '%s' is recursive", name)
+		}
+		visited[name] = true
+		item, _ := site.loadPost(site.themePath("layouts/" + name + ".html"))
+		if item == nil {
+			return "", fmt.Errorf("layout '%s' not found", name)
+		}
+		view["content"] = content
+		content = mustache(item["content"].(string), view, partials)
+		name, _ = item["layout"].(string)
+	}
+	return content, nil
+}
+
+func (site *website) renderPage(source string, destination string, root string) error {
+	if ok, err := site.renderPost(source, destination, root); ok {
+		return err
+	}
+	template, err := site.template(source)
+	if err != nil {
+		fmt.Fprintln(site.log, err)
+	} else {
+		var failure error
+		view := merge(site.configuration, site.data, site.functions)
+		view["root"] = root
+		view["blog"] = func() string {
+			data, err := site.renderBlog(site.posts(), path.Dir(destination), root, 0)
+			if err != nil {
+				failure = err
+				return ""
+			}
+			return data +
+				`<script type="text/javascript">
+function updateStream() {
+    var element = document.getElementById("stream");
+    if (element) {
+      var rect = element.getBoundingClientRect();
+      var threshold = 0;
+      if (rect.bottom > threshold && (window.innerHeight - rect.top) > threshold) {
+        var url = element.getAttribute("title");
+        var xmlHttp = new XMLHttpRequest();
+        xmlHttp.open("GET", url, true);
+        xmlHttp.onreadystatechange = function () {
+            if (xmlHttp.readyState == 4 && xmlHttp.status == 200) {
+                element.insertAdjacentHTML('beforebegin', xmlHttp.responseText);
+                element.parentNode.removeChild(element);
+                updateStream();
+            }
+        };
+        xmlHttp.send(null);
+      }
+    }
+}
+updateStream();
+window.addEventListener('scroll', function(e) {
+    updateStream();
+});
+</script>
+`
+		}
+		name, _ := site.localize(path.Base(source))
+		location := path.Dir(source)
+		if !strings.HasPrefix(name, "index.") {
+			location = strings.TrimSuffix(path.Dir(source)+"/"+name, path.Ext(name))
+		}
+		site.languageView(view, root, strings.TrimSuffix(strings.TrimPrefix(destination, site.destination+"/"), "index.html"), path.Dir(source)+"/"+name)
+		pages := make([]interface{}, 0)
+		for _, item := range site.option("pages").([]interface{}) {
+			page := item.(map[string]interface{})
+			target := mustache(page["url"].(string), view, nil)
+			active := strings.TrimSuffix(path.Join(path.Dir(source), target), ".html") == location
+			if visible, ok := page["visible"].(bool); (ok && visible) || active {
+				pages = append(pages, map[string]interface{}{"name": page["name"].(string), "url": page["url"].(string), "active": active})
+			}
+		}
+		view["pages"] = pages
+		layout := ""
+		page := &Page{Source: source, Destination: destination, Metadata: make(map[string]interface{})}
+		if strings.HasSuffix(source, ".md") || strings.HasPrefix(template, "---") {
+			item, err := site.loadPost(source)
+			if item == nil {
+				return err
+			}
+			if _, ok := item["title"]; !ok {
+				item["title"] = site.option("name")
+			}
+			layout, _ = item["layout"].(string)
+			if len(layout) == 0 && strings.HasSuffix(source, ".md") {
+				layout = "page"
+				if name, collection := site.collectionOf(path.Dir(source) + "/"); len(name) > 0 {
+					layout = collection["layout"].(string)
+				}
+			}
+			view = merge(view, item)
+			template = item["content"].(string)
+			page.Metadata = item
+		}
+		partials := func(name string) string {
+			data, err := site.template(site.themePath(name))
+			if err != nil {
+				fmt.Fprintln(site.log, err)
+			}
+			return string(data)
+		}
+		site.collectionsView(view, root, partials)
+		page.View = view
+		if ok, err := site.hook(page, func(hook Hook) error {
+			if hook, ok := hook.(TemplateHook); ok {
+				return hook.Template(page)
+			}
+			return nil
+		}); !ok {
+			return err
+		}
+		data := ""
+		if len(layout) > 0 {
+			data, err = site.renderLayout(layout, page.View, partials)
+			if err != nil {
+				return fmt.Errorf("%s: %w", source, err)
+			}
+		} else {
+			data = mustache(template, page.View, partials)
+		}
+		if failure != nil {
+			return failure
+		}
+		return site.output(page, data)
+	}
+	return nil
+}
+
+func (site *website) render(source string, destination string, root string) error {
+	extension := path.Ext(source)
+	switch extension {
+	case ".rss", ".atom":
+		fmt.Fprintln(site.log, destination)
+		return site.renderFeed(source, destination)
+	case ".html":
+		fmt.Fprintln(site.log, destination)
+		return site.renderPage(source, destination, root)
+	case ".md":
+		destination = strings.TrimSuffix(destination, ".md") + ".html"
+		fmt.Fprintln(site.log, destination)
+		return site.renderPage(source, destination, root)
+	}
+	site.renderFile(source, destination)
+	return nil
+}
+
+func (site *website) renderDir(source string, destination string, root string, queue *queue) {
+	site.mkdir(destination)
+	location := source
+	if items, err := os.ReadDir(resolve(site.root, location)); err == nil {
+		for _, item := range items {
+			name := item.Name()
+			if !strings.HasPrefix(name, ".") {
+				if item.IsDir() {
+					if strings.HasPrefix(source, "content/blog/") && strings.Count(source, "/") == 2 && !site.translated(source+name+"/index.md") {
+						if _, err := os.Stat(resolve(site.root, source+name+"/index.md")); err == nil {
+							continue
+						}
+					}
+					if location, ok := site.postLocation(source + name + "/"); ok {
+						site.renderDir(source+name+"/", path.Join(destination, root, location), strings.Repeat("../", strings.Count(location, "/")), queue)
+					} else {
+						site.renderDir(source+name+"/", destination+"/"+name, root+"../", queue)
+					}
+				} else if target, ok := site.localize(name); ok && (target != name || site.localized(source+name) == source+name) {
+					queue.add(site, destination+"/"+target, source+name, func(site *website) error {
+						return site.render(source+name, destination+"/"+target, root)
+					})
+				}
+			}
+		}
+	}
+}
+
+func list(value interface{}) []string {
+	switch value := value.(type) {
+	case []string:
+		return value
+	case string:
+		return strings.FieldsFunc(strings.Trim(value, "[]"), func(c rune) bool {
+			return c == ',' || c == ' '
+		})
+	}
+	return nil
+}
+
+func (site *website) renderAliases() []string {
+	lines := []string{}
+	for _, folder := range site.posts() {
+		item, _ := site.loadPost(site.localized("content/blog/" + folder + "/index.md"))
+		if item != nil && (item["state"] == "post" || site.environment != "production") {
+			location := site.permalink(folder, item)
+			for _, alias := range list(item["aliases"]) {
+				alias = "/" + strings.TrimPrefix(alias, "/")
+				lines = append(lines, fmt.Sprintf("%-14s %-15s 301", alias, "/"+site.prefix+location))
+				file := strings.TrimPrefix(alias, "/")
+				if strings.HasSuffix(alias, "/") || path.Ext(alias) == "" {
+					file = path.Join(file, "index.html")
+				}
+				root := strings.Repeat("../", strings.Count(file, "/"))
+				file = path.Join(site.base, file)
+				if site.claimed(file) {
+					fmt.Fprintln(site.log, "Alias '"+alias+"' conflicts with '"+file+"'.")
+					continue
+				}
+				url := html.EscapeString(root + site.prefix + location)
+				canonical := ""
+				if host, _ := site.option("host").(string); len(host) > 0 {
+					canonical = "<link rel=\"canonical\" href=\"" + html.EscapeString(host+"/"+location) + "\" />\n"
+				}
+				data := `<!DOCTYPE html>
+<html>
+<head>
+<title>Redirect</title>
+` + canonical + `<meta name="robots" content="noindex" />
+<meta http-equiv="refresh" content="0; url=` + url + `" />
+</head>
+<body>
+<a href="` + url + `">` + url + `</a>
+</body>
+</html>`
+				site.mkdir(path.Dir(file))
+				site.write(file, []byte(data))
+			}
+		}
+	}
+	return lines
+}
+
+func (site *website) claimed(file string) bool {
+	if site.files != nil {
+		_, ok := site.files[file]
+		return ok
+	}
+	return site.manifest.claimed(file) || slices.Contains(site.record.Outputs, file)
+}
+
+func (site *website) renderRedirects(aliases []string) {
+	lines := []string{}
+	if data, err := site.readFile("redirect.map"); err == nil {
+		for _, line := range regexp.MustCompile("\\r\\n?|\\n").Split(string(data), -1) {
+			if len(strings.TrimSpace(line)) > 0 {
+				lines = append(lines, line)
+			}
+		}
+	}
+	data := []byte(strings.Join(append(lines, aliases...), "\n") + "\n")
+	for _, name := range []string{"redirect.map", "_redirects"} {
+		fmt.Fprintln(site.log, site.destination+"/"+name)
+		site.write(site.destination+"/"+name, data)
+	}
+}
+
+func flatten(target map[string]interface{}, name string, value interface{}) {
+	target[name] = value
+	if value, ok := value.(map[string]interface{}); ok {
+		for key, item := range value {
+			flatten(target, name+"."+key, item)
+		}
+	}
+}
+
+func (site *Site) loadData(data map[string]interface{}, directory string, name string) {
+	items, err := os.ReadDir(resolve(site.options.Root, directory))
+	if err != nil {
+		return
+	}
+	for _, item := range items {
+		if strings.HasPrefix(item.Name(), ".") {
+			continue
+		}
+		file := directory + item.Name()
+		key := name + "." + strings.TrimSuffix(item.Name(), path.Ext(item.Name()))
+		if item.IsDir() {
+			site.loadData(data, file+"/", name+"."+item.Name())
+			continue
+		}
+		buffer, err := os.ReadFile(resolve(site.options.Root, file))
+		if err != nil {
+			fmt.Fprintln(site.options.Log, err)
+			continue
+		}
+		switch path.Ext(file) {
+		case ".json":
+			var value interface{}
+			if err := json.Unmarshal(buffer, &value); err != nil {
+				fmt.Fprintln(site.options.Log, file+": "+err.Error())
+				continue
+			}
+			flatten(data, key, value)
+		case ".csv":
+			records, err := csv.NewReader(bytes.NewReader(buffer)).ReadAll()
+			if err != nil {
+				fmt.Fprintln(site.options.Log, file+": "+err.Error())
+				continue
+			}
+			rows := make([]interface{}, 0)
+			for index, record := range records {
+				if index > 0 {
+					row := make(map[string]interface{})
+					for column, header := range records[0] {
+						if column < len(record) {
+							row[strings.TrimSpace(header)] = record[column]
+						}
+					}
+					rows = append(rows, row)
+				}
+			}
+			data[key] = rows
+		}
+	}
+}
+
+func (site *website) copyDir(source string, destination string, queue *queue) {
+	site.mkdir(destination)
+	if items, err := os.ReadDir(resolve(site.root, source)); err == nil {
+		for _, item := range items {
+			name := item.Name()
+			if !strings.HasPrefix(name, ".") {
+				if item.IsDir() {
+					site.copyDir(source+name+"/", destination+"/"+name, queue)
+				} else {
+					queue.add(site, destination+"/"+name, source+name, func(site *website) error {
+						site.renderFile(source+name, destination+"/"+name)
+						return nil
+					})
+				}
+			}
+		}
+	}
+}
+
+func cleanDir(directory string) {
+	if items, err := os.ReadDir(directory); err == nil {
+		for _, item := range items {
+			os.RemoveAll(path.Join(directory, item.Name()))
+		}
+	}
+}
+
+type dependencies struct {
+	Source        string            `json:"source,omitempty"`
+	Outputs       []string          `json:"outputs"`
+	Files         map[string]string `json:"files"`
+	Configuration map[string]string `json:"configuration"`
+	Redirects     []string          `json:"redirects,omitempty"`
+}
+
+func newDependencies() *dependencies {
+	return &dependencies{
+		Outputs:       []string{},
+		Files:         make(map[string]string),
+		Configuration: make(map[string]string),
+	}
+}
+
+func (record *dependencies) merge(other *dependencies) {
+	if record != nil && other != nil {
+		for key, value := range other.Files {
+			record.Files[key] = value
+		}
+		for key, value := range other.Configuration {
+			record.Configuration[key] = value
+		}
+	}
+}
+
+type manifest struct {
+	Environment string                   `json:"environment"`
+	Theme       string                   `json:"theme"`
+	Generator   string                   `json:"generator"`
+	Units       map[string]*dependencies `json:"units"`
+	destination string
+	root        string
+	file        string
+	previous    map[string]*dependencies
+	outputs     map[string]bool
+	directories map[string]bool
+	hashes      map[string]string
+	mutex       sync.Mutex
+}
+
+var generator = sync.OnceValue(func() string {
+	if file, err := os.Executable(); err == nil {
+		if data, err := os.ReadFile(file); err == nil {
+			return fmt.Sprintf("%x", sha1.Sum(data))
+		}
+	}
+	return ""
+})
+
+func loadManifest(root string, destination string, environment string, theme string, fingerprint string) *manifest {
+	manifest := &manifest{
+		Environment: environment,
+		Theme:       theme,
+		Generator:   fingerprint,
+		Units:       make(map[string]*dependencies),
+		destination: destination,
+		root:        root,
+		file:        ".cache/" + strings.NewReplacer("/", "_", ".", "_").Replace(path.Clean(destination)) + ".json",
+		previous:    make(map[string]*dependencies),
+		outputs:     make(map[string]bool),
+		directories: make(map[string]bool),
+		hashes:      make(map[string]string),
+	}
+	previous := &struct {
+		Environment string                   `json:"environment"`
+		Theme       string                   `json:"theme"`
+		Generator   string                   `json:"generator"`
+		Units       map[string]*dependencies `json:"units"`
+	}{}
+	if data, err := os.ReadFile(resolve(root, manifest.file)); err == nil && json.Unmarshal(data, previous) == nil {
+		if previous.Environment == environment && previous.Theme == theme && previous.Generator == manifest.Generator && previous.Units != nil {
+			manifest.previous = previous.Units
+		}
+	}
+	return manifest
+}
+
+func (manifest *manifest) hash(file string) string {
+	manifest.mutex.Lock()
+	value, ok := manifest.hashes[file]
+	manifest.mutex.Unlock()
+	if ok {
+		return value
+	}
+	if stat, err := os.Stat(resolve(manifest.root, file)); err == nil {
+		hash := sha1.New()
+		if stat.IsDir() {
+			items, _ := os.ReadDir(resolve(manifest.root, file))
+			for _, item := range items {
+				if item.IsDir() {
+					io.WriteString(hash, item.Name()+"/\n")
+				} else {
+					io.WriteString(hash, item.Name()+"\n")
+				}
+			}
+		} else if data, err := os.ReadFile(resolve(manifest.root, file)); err == nil {
+			hash.Write(data)
+		}
+		value = hex.EncodeToString(hash.Sum(nil))
+	}
+	manifest.mutex.Lock()
+	manifest.hashes[file] = value
+	manifest.mutex.Unlock()
+	return value
+}
+
+func (manifest *manifest) claimed(file string) bool {
+	manifest.mutex.Lock()
+	defer manifest.mutex.Unlock()
+	return manifest.outputs[file]
+}
+
+func (manifest *manifest) current(site *website, key string) *dependencies {
+	record, ok := manifest.previous[key]
+	if !ok {
+		return nil
+	}
+	for file, hash := range record.Files {
+		if manifest.hash(file) != hash {
+			return nil
+		}
+	}
+	for name, hash := range record.Configuration {
+		if site.optionHash(name) != hash {
+			return nil
+		}
+	}
+	for _, file := range record.Outputs {
+		if _, err := os.Stat(resolve(manifest.root, file)); err != nil || manifest.claimed(file) {
+			return nil
+		}
+	}
+	return record
+}
+
+func (manifest *manifest) commit(key string, record *dependencies) {
+	manifest.mutex.Lock()
+	defer manifest.mutex.Unlock()
+	manifest.Units[key] = record
+	for _, file := range record.Outputs {
+		manifest.outputs[file] = true
+	}
+}
+
+func (manifest *manifest) save() error {
+	for _, record := range manifest.previous {
+		for _, file := range record.Outputs {
+			if !manifest.outputs[file] {
+				os.Remove(resolve(manifest.root, file))
+				for directory := path.Dir(file); directory != "." && directory != "/" && !manifest.directories[directory]; directory = path.Dir(directory) {
+					if os.Remove(resolve(manifest.root, directory)) != nil {
+						break
+					}
+				}
+			}
+		}
+	}
+	data, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return err
+	}
+	file := resolve(manifest.root, manifest.file)
+	os.MkdirAll(path.Dir(file), os.ModePerm)
+	return os.WriteFile(file, data, os.ModePerm)
+}
+
+type task struct {
+	site   *website
+	source string
+	render func(site *website) error
+}
+
+type queue struct {
+	keys  []string
+	tasks map[string]task
+}
+
+func (queue *queue) add(site *website, key string, source string, render func(site *website) error) {
+	if _, ok := queue.tasks[key]; !ok {
+		queue.keys = append(queue.keys, key)
+	}
+	queue.tasks[key] = task{site: site, source: source, render: render}
+}
+
+func (queue *queue) run(pool *pool) {
+	pool.run(len(queue.keys), func(index int) {
+		key := queue.keys[index]
+		task := queue.tasks[key]
+		if _, err := task.site.update(key, task.source, task.render); err != nil {
+			pool.failures.Add(1)
+			fmt.Fprintln(pool.log, err)
+		}
+	})
+}
+
+type pool struct {
+	workers  chan struct{}
+	failures atomic.Int32
+	log      io.Writer
+}
+
+func (pool *pool) recovered() {
+	if err := recover(); err != nil {
+		pool.failures.Add(1)
+		fmt.Fprintln(pool.log, err)
+	}
+}
+
+func (pool *pool) run(count int, work func(index int)) {
+	group := sync.WaitGroup{}
+	for index := 0; index < count; index++ {
+		group.Add(1)
+		pool.workers <- struct{}{}
+		go func(index int) {
+			defer group.Done()
+			defer func() { <-pool.workers }()
+			defer pool.recovered()
+			work(index)
+		}(index)
+	}
+	group.Wait()
+}
+
+func (site *website) hook(page *Page, call func(hook Hook) error) (bool, error) {
+	for _, hook := range site.hooks {
+		if err := call(hook); err == Skip {
+			return false, nil
+		} else if err != nil {
+			return false, fmt.Errorf("%s: %w", page.Source, err)
+		}
+	}
+	return true, nil
+}
+
+func (site *website) output(page *Page, data string) error {
+	page.Output = []byte(data)
+	ok, err := site.hook(page, func(hook Hook) error {
+		if hook, ok := hook.(OutputHook); ok {
+			return hook.Output(page)
+		}
+		return nil
+	})
+	if ok {
+		site.write(page.Destination, page.Output)
+	}
+	return err
+}
+
+func (site *website) track(record *dependencies) *website {
+	scope := *site
+	scope.record = record
+	return &scope
+}
+
+func (site *website) update(key string, source string, render func(site *website) error) (*dependencies, error) {
+	record := site.manifest.current(site, key)
+	if record == nil {
+		record = newDependencies()
+		if err := render(site.track(record)); err != nil {
+			return record, err
+		}
+	}
+	record.Source = source
+	site.manifest.commit(key, record)
+	return record, nil
+}
+
+func (site *website) depend(file string) {
+	if site.record != nil && site.manifest != nil {
+		site.record.Files[file] = site.manifest.hash(file)
+	}
+}
+
+func (site *website) exists(file string) bool {
+	site.depend(file)
+	_, err := os.Stat(resolve(site.root, file))
+	return err == nil
+}
+
+func (site *website) readDir(directory string) []os.DirEntry {
+	site.depend(directory)
+	items, _ := os.ReadDir(resolve(site.root, directory))
+	return items
+}
+
+func (site *website) readFile(file string) ([]byte, error) {
+	site.depend(file)
+	return os.ReadFile(resolve(site.root, file))
+}
+
+func (site *website) template(file string) (string, error) {
+	data, err := site.readFile(file)
+	site.variables(string(data))
+	return string(data), err
+}
+
+func (site *website) variables(text string) {
+	if site.record != nil {
+		for _, match := range variableRegexp.FindAllStringSubmatch(text, -1) {
+			if !strings.HasPrefix(match[1], "/") {
+				site.record.Configuration[match[1]] = site.optionHash(match[1])
+			}
+		}
+	}
+}
+
+func (site *website) option(key string) interface{} {
+	if site.record != nil {
+		site.record.Configuration[key] = site.optionHash(key)
+	}
+	return site.configuration[key]
+}
+
+func (site *website) optionHash(key string) string {
+	data, _ := json.Marshal([]interface{}{site.configuration[key], site.data[key]})
+	return fmt.Sprintf("%x", sha1.Sum(data))
+}
+
+func (site *website) write(file string, data []byte) {
+	if site.files != nil {
+		site.files[path.Clean(file)] = data
+		return
+	}
+	if site.record != nil {
+		site.record.Outputs = append(site.record.Outputs, file)
+	}
+	if current, err := os.ReadFile(resolve(site.root, file)); err == nil && bytes.Equal(current, data) {
+		return
+	}
+	if err := os.WriteFile(resolve(site.root, file), data, os.ModePerm); err != nil {
+		fmt.Fprintln(site.log, err)
+	}
+}
+
+func (site *website) mkdir(directory string) {
+	if site.files != nil {
+		return
+	}
+	if site.manifest != nil {
+		site.manifest.mutex.Lock()
+		for item := path.Clean(directory); item != "." && item != "/"; item = path.Dir(item) {
+			site.manifest.directories[item] = true
+		}
+		site.manifest.mutex.Unlock()
+	}
+	os.MkdirAll(resolve(site.root, directory), os.ModePerm)
+}
+
+func newWebsite(configuration map[string]interface{}, data map[string]interface{}, theme string, destination string, environment string, root string, log io.Writer) *website {
+	site := &website{
+		data:        data,
+		environment: environment,
+		destination: destination,
+		theme:       theme,
+		base:        destination,
+		root:        root,
+		log:         log,
+		cache:       make(map[string]*entry),
+		mutex:       &sync.Mutex{},
+	}
+	defaults := make([]map[string]interface{}, 0)
+	for name := theme; len(name) > 0 && !slices.Contains(site.themes, name); {
+		config := site.loadTheme(name)
+		site.themes = append(site.themes, name)
+		name, _ = config["extends"].(string)
+		delete(config, "extends")
+		defaults = append([]map[string]interface{}{config}, defaults...)
+	}
+	site.configuration = merge(append(defaults, configuration)...)
+	site.configuration["theme"] = theme
+	delete(site.configuration, "sites")
+	if name, ok := site.configuration["timezone"].(string); ok && len(name) > 0 {
+		if location, err := time.LoadLocation(name); err != nil {
+			fmt.Fprintln(site.log, err)
+		} else {
+			site.timezone = location
+		}
+	}
+	if languages := site.languages(); len(languages) > 0 {
+		site.language = languages[0]["code"].(string)
+	}
+	return site
+}
+
+func (site *website) translations() []*website {
+	sites := []*website{}
+	for index, language := range site.languages() {
+		if index > 0 {
+			code := language["code"].(string)
+			configuration := merge(site.configuration, language)
+			delete(configuration, "code")
+			delete(configuration, "label")
+			if host, ok := site.configuration["host"].(string); ok {
+				configuration["host"] = host + "/" + code
+			}
+			translation := newWebsite(configuration, site.data, site.theme, site.destination+"/"+code, site.environment, site.root, site.log)
+			translation.language = code
+			translation.pool = site.pool
+			translation.documents = site.documents
+			translation.functions = site.functions
+			translation.hooks = site.hooks
+			translation.prefix = code + "/"
+			translation.base = site.destination
+			sites = append(sites, translation)
+		}
+	}
+	return sites
+}
+
+func (site *website) fingerprint() string {
+	items := []string{generator()}
+	for _, hook := range site.hooks {
+		items = append(items, fmt.Sprintf("%T%+v", hook, hook))
+	}
+	for name := range site.functions {
+		items = append(items, name)
+	}
+	sort.Strings(items[1:])
+	return fmt.Sprintf("%x", sha1.Sum([]byte(strings.Join(items, "\n"))))
+}
+
+func (site *website) build() {
+	site.manifest = loadManifest(site.root, site.destination, site.environment, site.theme, site.fingerprint())
+	if len(site.manifest.previous) == 0 {
+		cleanDir(resolve(site.root, site.destination))
+	}
+	sites := append([]*website{site}, site.translations()...)
+	queue := &queue{tasks: make(map[string]task)}
+	for _, item := range sites {
+		item.manifest = site.manifest
+		item.loadPosts()
+		chain := item.themes
+		for index := len(chain) - 1; index >= 0; index-- {
+			if stat, err := os.Stat(resolve(item.root, "themes/"+chain[index]+"/static/")); err == nil && stat.IsDir() {
+				item.copyDir("themes/"+chain[index]+"/static/", item.destination, queue)
+			}
+		}
+		item.renderDir("content/", item.destination, "", queue)
+	}
+	queue.run(site.pool)
+	aliases := []string{}
+	for _, item := range sites {
+		record, _ := item.update(item.destination+"#aliases", "content/blog/", func(site *website) error {
+			site.record.Redirects = site.renderAliases()
+			return nil
+		})
+		aliases = append(aliases, record.Redirects...)
+	}
+	record := newDependencies()
+	record.Source = "redirect.map"
+	site.track(record).renderRedirects(aliases)
+	site.manifest.commit(site.destination+"#redirects", record)
+	if err := site.manifest.save(); err != nil {
+		fmt.Fprintln(site.log, err)
+	}
+}
+
+func (site *Site) loadConfiguration(theme string) (map[string]interface{}, map[string]interface{}, string, error) {
+	var configuration map[string]interface{}
+	file, err := os.ReadFile(resolve(site.options.Root, "content.json"))
+	if err != nil {
+		return nil, nil, "", err
+	}
+	err = json.Unmarshal(file, &configuration)
+	if err != nil {
+		return nil, nil, "", err
+	}
+	if len(theme) == 0 {
+		theme = "default"
+		if value, ok := configuration["theme"].(string); ok && len(value) > 0 {
+			theme = value
+		}
+	}
+	data := make(map[string]interface{})
+	site.loadData(data, "data/", "data")
+	return configuration, data, theme, nil
+}
+
+// Function is a custom template function. A section like {{#name}}text{{/name}}
+// calls it with the rendered text and a variable like {{name}} with an empty
+// string. The result of {{name}} is escaped.
+type Function func(text string) string
+
+// Hook is implemented by values passed in Options.Hooks. A hook is called for
+// each of the hook interfaces it implements.
+type Hook interface{}
+
+// LoadHook is called after content.json and data/ are loaded and can modify
+// the configuration and data before anything is rendered.
+type LoadHook interface {
+	Load(configuration map[string]interface{}, data map[string]interface{}) error
+}
+
+// Page is the model passed to page hooks. Hooks modify a page by changing its
+// fields and veto it by returning Skip.
+type Page struct {
+	// Source is the file in content/ or the template the page is rendered from.
+	Source string
+	// Destination is the output file.
+	Destination string
+	// Metadata is the front matter of the page.
+	Metadata map[string]interface{}
+	// Content is the body of the page, as markdown before and as HTML after the markdown is rendered.
+	Content string
+	// View is the template view.
+	View map[string]interface{}
+	// Output is the rendered page.
+	Output []byte
+}
+
+// Skip is returned by a page hook to drop the page. A skipped post is removed
+// from the blog and feeds and a skipped output is not written. Any other error
+// fails the page, Build reports it and Render responds with status 500.
+var Skip = errors.New("skip")
+
+// FrontMatterHook is called after the front matter of a file in content/ is
+// parsed and before its markdown is rendered.
+type FrontMatterHook interface {
+	FrontMatter(page *Page) error
+}
+
+// MarkdownHook is called after the markdown of a file in content/ is rendered.
+type MarkdownHook interface {
+	Markdown(page *Page) error
+}
+
+// TemplateHook is called before a page or feed is rendered with its view.
+type TemplateHook interface {
+	Template(page *Page) error
+}
+
+// OutputHook is called after a page or feed is rendered and before it is written.
+type OutputHook interface {
+	Output(page *Page) error
+}
+
+// BuildHook is called after a site is built with its destination and all outputs.
+type BuildHook interface {
+	Build(destination string, outputs []string) error
+}
+
+// Options configure a Site. Paths are relative to Root which contains
+// content.json, content/ and themes/.
+type Options struct {
+	// Root is the folder of the website, defaults to the working directory.
+	Root        string
+	Environment string
+	Destination string
+	Theme       string
+	Sites       bool
+	Jobs        int
+	Functions   map[string]Function
+	Hooks       []Hook
+	// External enables checking outbound links in posts with Check.
+	External bool
+	// Client sends the requests for external links, defaults to a client with a 10s timeout.
+	Client *http.Client
+	// Interval is the minimum time between requests to the same host, defaults to 1s.
+	Interval time.Duration
+	// Log receives the progress and warnings of a Site, defaults to os.Stdout.
+	Log io.Writer
+}
+
+// Site is a website that is built to a destination folder or rendered on demand.
+type Site struct {
+	options   Options
+	content   *content
+	pool      *pool
+	manifests []*manifest
+	mutex     sync.Mutex
+	wait      func(until time.Time)
+}
+
+type content struct {
+	configuration map[string]interface{}
+	data          map[string]interface{}
+	theme         string
+	documents     *documents
+}
+
+// New creates a Site. Jobs defaults to the number of CPUs and Destination to 'build'.
+func New(options Options) *Site {
+	if options.Jobs < 1 {
+		options.Jobs = runtime.NumCPU()
+	}
+	if len(options.Destination) == 0 {
+		options.Destination = "build"
+	}
+	if options.Client == nil {
+		options.Client = &http.Client{Timeout: 10 * time.Second}
+	}
+	if options.Interval <= 0 {
+		options.Interval = time.Second
+	}
+	if options.Log == nil {
+		options.Log = os.Stdout
+	}
+	wait := func(until time.Time) {
+		time.Sleep(time.Until(until))
+	}
+	return &Site{options: options, pool: &pool{workers: make(chan struct{}, options.Jobs), log: options.Log}, wait: wait}
+}
+
+// Load reads content.json, the theme and data/. Call Load again to pick up changes.
+func (site *Site) Load() error {
+	configuration, data, theme, err := site.loadConfiguration(site.options.Theme)
+	if err != nil {
+		return err
+	}
+	for _, hook := range site.options.Hooks {
+		if hook, ok := hook.(LoadHook); ok {
+			if err := hook.Load(configuration, data); err != nil {
+				return err
+			}
+		}
+	}
+	site.mutex.Lock()
+	site.content = &content{
+		configuration: configuration,
+		data:          data,
+		theme:         theme,
+		documents:     &documents{items: make(map[string]*document), root: site.options.Root, log: site.options.Log},
+	}
+	site.mutex.Unlock()
+	return nil
+}
+
+func (site *Site) current() (*content, error) {
+	site.mutex.Lock()
+	content := site.content
+	site.mutex.Unlock()
+	if content == nil {
+		if err := site.Load(); err != nil {
+			return nil, err
+		}
+		return site.current()
+	}
+	return content, nil
+}
+
+func (site *Site) website(content *content, configuration map[string]interface{}, theme string, destination string, environment string) *website {
+	functions := make(map[string]interface{})
+	for name, function := range site.options.Functions {
+		functions[name] = function
+	}
+	item := newWebsite(configuration, content.data, theme, destination, environment, site.options.Root, site.options.Log)
+	item.pool = site.pool
+	item.documents = content.documents
+	item.functions = functions
+	item.hooks = site.options.Hooks
+	return item
+}
+
+var slugRegexp = regexp.MustCompile("[^\\p{L}\\p{N}]+")
+
+func slugify(title string) string {
+	title = strings.NewReplacer("'", "", "’", "").Replace(strings.ToLower(title))
+	return strings.Trim(slugRegexp.ReplaceAllString(title, "-"), "-")
+}
+
+// Create creates a draft post, page or collection item from archetypes/<kind>.md,
+// or archetypes/default.md, and returns its file. Posts are created in a dated
+// folder in content/blog/. Titles that start or end with a quote or span
+// several lines are rejected as they do not survive the front matter.
+func (site *Site) Create(kind string, title string) (string, error) {
+	content, err := site.current()
+	if err != nil {
+		return "", err
+	}
+	item := site.website(content, content.configuration, content.theme, site.options.Destination, site.options.Environment)
+	slug := slugify(title)
+	if len(slug) == 0 || strings.Trim(title, " \"") != title || strings.ContainsAny(title, "\r\n") {
+		return "", fmt.Errorf("invalid title '%s'", title)
+	}
+	now := time.Now()
+	folder := ""
+	if kind == "post" {
+		folder = "content/blog/" + now.Format("2006-01-02") + "-" + slug + "/"
+	} else if kind == "page" {
+		folder = "content/" + slug + "/"
+	} else if collection := item.collection(kind); collection != nil {
+		folder = "content/" + collection["folder"].(string) + "/" + slug + "/"
+	} else {
+		return "", fmt.Errorf("unknown kind '%s'", kind)
+	}
+	if _, err := os.Stat(resolve(site.options.Root, folder)); err == nil {
+		return "", fmt.Errorf("'%s' already exists", folder)
+	}
+	template, err := os.ReadFile(resolve(site.options.Root, "archetypes/"+kind+".md"))
+	if os.IsNotExist(err) {
+		template, err = os.ReadFile(resolve(site.options.Root, "archetypes/default.md"))
+	}
+	if err != nil {
+		return "", err
+	}
+	author, _ := item.option("name").(string)
+	view := map[string]interface{}{
+		"title":  title,
+		"slug":   slug,
+		"date":   now.Format("2006-01-02 15:04:05 -07:00"),
+		"author": author,
+	}
+	if err := os.MkdirAll(resolve(site.options.Root, folder), os.ModePerm); err != nil {
+		return "", err
+	}
+	file := folder + "index.md"
+	return file, os.WriteFile(resolve(site.options.Root, file), []byte(mustache(string(template), view, nil)), os.ModePerm)
+}
+
+// Build renders the website to the destination folder and only rewrites
+// outputs whose sources changed since the last build. With Options.Sites
+// every site variant in content.json is built to its destination relative
+// to Options.Destination, which defaults to the theme name.
+func (site *Site) Build() error {
+	content, err := site.current()
+	if err != nil {
+		return err
+	}
+	environment := site.options.Environment
+	destination := site.options.Destination
+	site.pool.failures.Store(0)
+	sites := []*website{}
+	if variants, ok := content.configuration["sites"].([]interface{}); ok && site.options.Sites {
+		for _, item := range variants {
+			variant := merge(content.configuration, item.(map[string]interface{}))
+			name, _ := variant["theme"].(string)
+			if len(name) == 0 {
+				name = content.theme
+			}
+			target, ok := variant["destination"].(string)
+			if !ok {
+				target = name
+			}
+			if !path.IsAbs(target) {
+				target = path.Join(destination, target)
+			}
+			mode, ok := variant["environment"].(string)
+			if !ok {
+				mode = environment
+			}
+			delete(variant, "destination")
+			delete(variant, "environment")
+			sites = append(sites, site.website(content, variant, name, target, mode))
+		}
+	} else {
+		sites = append(sites, site.website(content, content.configuration, content.theme, destination, environment))
+	}
+	group := sync.WaitGroup{}
+	for _, item := range sites {
+		group.Add(1)
+		go func(item *website) {
+			defer group.Done()
+			defer site.pool.recovered()
+			item.build()
+		}(item)
+	}
+	group.Wait()
+	if count := site.pool.failures.Load(); count > 0 {
+		return fmt.Errorf("build failed with %d error(s)", count)
+	}
+	manifests := []*manifest{}
+	for _, item := range sites {
+		manifests = append(manifests, item.manifest)
+	}
+	site.mutex.Lock()
+	site.manifests = manifests
+	site.mutex.Unlock()
+	for _, item := range sites {
+		outputs := []string{}
+		for file := range item.manifest.outputs {
+			outputs = append(outputs, file)
+		}
+		sort.Strings(outputs)
+		for _, hook := range site.options.Hooks {
+			if hook, ok := hook.(BuildHook); ok {
+				if err := hook.Build(item.destination, outputs); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// Render renders the output for a request on demand without writing to the
+// destination folder and returns the status code, headers and body.
+func (site *Site) Render(request *http.Request) (int, map[string]string, []byte) {
+	content, err := site.current()
+	if err != nil {
+		fmt.Fprintln(site.options.Log, err)
+		return 500, map[string]string{"Content-Type": "text/plain; charset=utf-8"}, []byte(err.Error())
+	}
+	configuration := merge(content.configuration)
+	delete(configuration, "host")
+	root := site.website(content, configuration, content.theme, ".", site.options.Environment)
+	root.configuration["host"] = root.host(request)
+	root.files = make(map[string][]byte)
+	queue := &queue{tasks: make(map[string]task)}
+	sites := append([]*website{root}, root.translations()...)
+	for _, item := range sites {
+		item.files = root.files
+		chain := item.themes
+		for index := len(chain) - 1; index >= 0; index-- {
+			if stat, err := os.Stat(resolve(item.root, "themes/"+chain[index]+"/static/")); err == nil && stat.IsDir() {
+				item.copyDir("themes/"+chain[index]+"/static/", item.destination, queue)
+			}
+		}
+		item.renderDir("content/", item.destination, "", queue)
+	}
+	var failure error
+	aliased := false
+	render := func(file string) ([]byte, bool) {
+		for key, task := range queue.tasks {
+			if path.Clean(key) == file || path.Clean(strings.TrimSuffix(key, ".md")+".html") == file {
+				func() {
+					defer site.pool.recovered()
+					if err := task.render(task.site); err != nil && failure == nil {
+						failure = err
+					}
+				}()
+			}
+		}
+		data, ok := root.files[file]
+		if !ok && !aliased {
+			aliased = true
+			for _, item := range sites {
+				item.renderAliases()
+			}
+			data, ok = root.files[file]
+		}
+		return data, ok
+	}
+	file := path.Clean("." + request.URL.Path)
+	if strings.HasSuffix(request.URL.Path, "/") {
+		file = path.Join(file, "index.html")
+	}
+	data, ok := render(file)
+	if !ok && strings.HasPrefix(file, "blog/page") {
+		render("index.html")
+		data, ok = root.files[file]
+	}
+	if !ok && path.Ext(file) == "" {
+		if _, ok := render(path.Join(file, "index.html")); ok {
+			return 302, map[string]string{"Location": request.URL.Path + "/"}, nil
+		}
+	}
+	if failure != nil {
+		fmt.Fprintln(site.options.Log, failure)
+		return 500, map[string]string{"Content-Type": "text/plain; charset=utf-8"}, []byte(failure.Error())
+	}
+	statusCode := 200
+	if !ok {
+		statusCode = 404
+		file = "404.html"
+		if data, ok = render(file); !ok {
+			return 404, map[string]string{"Content-Type": "text/plain; charset=utf-8"}, []byte("404")
+		}
+	}
+	contentType := mime.TypeByExtension(path.Ext(file))
+	if len(contentType) == 0 {
+		contentType = "application/octet-stream"
+	}
+	return statusCode, map[string]string{"Content-Type": contentType}, data
+}
+
+// Link is a broken or redirected link found by Check.
+type Link struct {
+	// Source is the file in content/ or themes/ the output was rendered from.
+	Source string
+	// File is the output file that contains the link.
+	File string
+	// URL is the href or src of the link.
+	URL string
+	// Status is the HTTP status code of the link, or 404 for missing internal links.
+	Status int
+	// Redirects are the locations an external link redirects to.
+	Redirects []string
+	// Error is the error of a failed external request.
+	Error string
+}
+
+// Broken reports whether the link failed or returned a 4xx or 5xx status code.
+func (link Link) Broken() bool {
+	return len(link.Error) > 0 || link.Status >= 400
+}
+
+var linkRegexp = regexp.MustCompile(`\s(?:href|src)\s*=\s*(?:"([^"]*)"|'([^']*)')`)
+var anchorRegexp = regexp.MustCompile(`\s(?:id|name)\s*=\s*(?:"([^"]*)"|'([^']*)')`)
+
+func resolveLink(folder string, root string, file string, link string, anchors func(file string) map[string]bool) bool {
+	if len(link) == 0 || link == "#" || schemeRegexp.MatchString(link) {
+		return true
+	}
+	location, fragment, _ := strings.Cut(link, "#")
+	location, _, _ = strings.Cut(location, "?")
+	if value, err := url.PathUnescape(location); err == nil {
+		location = value
+	}
+	target := file
+	if strings.HasPrefix(location, "{{{root}}}") {
+		target = path.Join(root, strings.TrimPrefix(location, "{{{root}}}"))
+	} else if strings.HasPrefix(location, "/") {
+		target = path.Join(root, location)
+	} else if len(location) > 0 {
+		target = path.Join(path.Dir(file), location)
+	}
+	if stat, err := os.Stat(resolve(folder, target)); err != nil {
+		return false
+	} else if stat.IsDir() {
+		target = path.Join(target, "index.html")
+		if _, err := os.Stat(resolve(folder, target)); err != nil {
+			return false
+		}
+	}
+	return len(fragment) == 0 || anchors(target)[fragment]
+}
+
+// Check resolves the href and src links in the HTML outputs of the last Build
+// against the destination folder, including {{{root}}} relative links and
+// #fragment targets, and returns the broken links. With Options.External the
+// http and https links in posts are requested as well, at most one request per
+// Options.Interval and host, and returned when broken or redirected. External
+// results are cached in .cache/links.json for a day unless they failed.
+func (site *Site) Check() ([]Link, error) {
+	site.mutex.Lock()
+	manifests := site.manifests
+	site.mutex.Unlock()
+	if len(manifests) == 0 {
+		return nil, errors.New("build the website before checking links")
+	}
+	cache := make(map[string]map[string]bool)
+	anchors := func(file string) map[string]bool {
+		if _, ok := cache[file]; !ok {
+			cache[file] = make(map[string]bool)
+			if data, err := os.ReadFile(resolve(site.options.Root, file)); err == nil {
+				for _, match := range anchorRegexp.FindAllStringSubmatch(string(data), -1) {
+					cache[file][html.UnescapeString(match[1]+match[2])] = true
+				}
+			}
+		}
+		return cache[file]
+	}
+	links := []Link{}
+	for _, manifest := range manifests {
+		keys := []string{}
+		for key := range manifest.Units {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			record := manifest.Units[key]
+			for _, file := range record.Outputs {
+				if path.Ext(file) != ".html" {
+					continue
+				}
+				data, err := os.ReadFile(resolve(site.options.Root, file))
+				if err != nil {
+					return nil, err
+				}
+				for _, match := range linkRegexp.FindAllStringSubmatch(string(data), -1) {
+					link := html.UnescapeString(match[1] + match[2])
+					if !resolveLink(site.options.Root, manifest.destination, file, link, anchors) {
+						links = append(links, Link{Source: record.Source, File: file, URL: link, Status: 404})
+					}
+				}
+			}
+		}
+	}
+	if site.options.External {
+		external, err := site.external(manifests)
+		if err != nil {
+			return nil, err
+		}
+		links = append(links, external...)
+	}
+	return links, nil
+}
+
+type result struct {
+	Status    int       `json:"status"`
+	Redirects []string  `json:"redirects,omitempty"`
+	Error     string    `json:"error,omitempty"`
+	Checked   time.Time `json:"checked"`
+}
+
+func (site *Site) fetch(link string, limit func(host string)) result {
+	client := *site.options.Client
+	client.CheckRedirect = func(request *http.Request, via []*http.Request) error {
+		return http.ErrUseLastResponse
+	}
+	result := result{Checked: time.Now()}
+	location := link
+	for {
+		var response *http.Response
+		var err error
+		for _, method := range []string{"HEAD", "GET"} {
+			request, e := http.NewRequest(method, location, nil)
+			if e != nil {
+				err = e
+				break
+			}
+			limit(request.URL.Host)
+			response, err = client.Do(request)
+			if err != nil {
+				break
+			}
+			response.Body.Close()
+			if response.StatusCode < 400 {
+				break
+			}
+		}
+		if err != nil {
+			result.Error = err.Error()
+			return result
+		}
+		result.Status = response.StatusCode
+		target := response.Header.Get("Location")
+		if response.StatusCode < 300 || response.StatusCode >= 400 || len(target) == 0 {
+			return result
+		}
+		if len(result.Redirects) == 10 {
+			result.Error = "too many redirects"
+			return result
+		}
+		next, err := response.Request.URL.Parse(target)
+		if err != nil {
+			result.Error = err.Error()
+			return result
+		}
+		location = next.String()
+		result.Redirects = append(result.Redirects, location)
+	}
+}
+
+func (site *Site) external(manifests []*manifest) ([]Link, error) {
+	content, err := site.current()
+	if err != nil {
+		return nil, err
+	}
+	reader := site.website(content, content.configuration, content.theme, site.options.Destination, site.options.Environment)
+	found := []Link{}
+	urls := []string{}
+	for _, manifest := range manifests {
+		keys := []string{}
+		for key := range manifest.Units {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			record := manifest.Units[key]
+			if !strings.HasPrefix(record.Source, "content/blog/") || path.Ext(record.Source) != ".md" || len(record.Outputs) == 0 {
+				continue
+			}
+			item, _ := reader.loadPost(record.Source)
+			if item == nil {
+				continue
+			}
+			text, _ := item["content"].(string)
+			for _, match := range linkRegexp.FindAllStringSubmatch(text, -1) {
+				link := html.UnescapeString(match[1] + match[2])
+				if strings.HasPrefix(link, "http://") || strings.HasPrefix(link, "https://") {
+					found = append(found, Link{Source: record.Source, File: record.Outputs[0], URL: link})
+					if !slices.Contains(urls, link) {
+						urls = append(urls, link)
+					}
+				}
+			}
+		}
+	}
+	file := ".cache/links.json"
+	cache := make(map[string]result)
+	if data, err := os.ReadFile(resolve(site.options.Root, file)); err == nil {
+		if err := json.Unmarshal(data, &cache); err != nil {
+			fmt.Fprintln(site.options.Log, file+": "+err.Error())
+		}
+	}
+	hosts := make(map[string]time.Time)
+	mutex := sync.Mutex{}
+	limit := func(host string) {
+		mutex.Lock()
+		now := time.Now()
+		next, ok := hosts[host]
+		if !ok || next.Before(now) {
+			next = now
+		}
+		hosts[host] = next.Add(site.options.Interval)
+		mutex.Unlock()
+		site.wait(next)
+	}
+	site.pool.run(len(urls), func(index int) {
+		link := urls[index]
+		mutex.Lock()
+		cached, ok := cache[link]
+		mutex.Unlock()
+		if ok && cached.Status < 400 && len(cached.Error) == 0 && time.Since(cached.Checked) < 24*time.Hour {
+			return
+		}
+		result := site.fetch(link, limit)
+		mutex.Lock()
+		cache[link] = result
+		mutex.Unlock()
+	})
+	data, err := json.MarshalIndent(cache, "", "  ")
+	if err == nil {
+		os.MkdirAll(path.Dir(resolve(site.options.Root, file)), os.ModePerm)
+		err = os.WriteFile(resolve(site.options.Root, file), data, os.ModePerm)
+	}
+	if err != nil {
+		fmt.Fprintln(site.options.Log, err)
+	}
+	links := []Link{}
+	for _, link := range found {
+		result := cache[link.URL]
+		link.Status = result.Status
+		link.Redirects = result.Redirects
+		link.Error = result.Error
+		if link.Broken() || len(link.Redirects) > 0 {
+			links = append(links, link)
+		}
+	}
+	return links, nil
+}
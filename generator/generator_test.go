@@ -0,0 +1,138 @@
+package generator
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestCheckExternal(t *testing.T) {
+	mutex := sync.Mutex{}
+	hits := make(map[string]int)
+	server := httptest.NewServer(http.HandlerFunc(func(response http.ResponseWriter, request *http.Request) {
+		mutex.Lock()
+		hits[request.Method+" "+request.URL.Path]++
+		mutex.Unlock()
+		switch request.URL.Path {
+		case "/ok", "/c":
+			response.WriteHeader(200)
+		case "/a":
+			http.Redirect(response, request, "/b", 301)
+		case "/b":
+			http.Redirect(response, request, "/c", 301)
+		case "/head":
+			if request.Method == "HEAD" {
+				response.WriteHeader(405)
+			} else {
+				response.WriteHeader(200)
+			}
+		default:
+			response.WriteHeader(404)
+		}
+	}))
+	defer server.Close()
+
+	folder := t.TempDir()
+	files := map[string]string{
+		"content.json":                          `{ "name": "Test", "host": "http://localhost", "pages": [] }`,
+		"themes/default/post.html":              "<html><body>{{{content}}}</body></html>",
+		"content/blog/2020-01-01-test/index.md": "---\ntitle: Test\n---\n\n[ok](" + server.URL + "/ok) [missing](" + server.URL + "/missing) [redirect](" + server.URL + "/a) [head](" + server.URL + "/head)\n",
+	}
+	for file, data := range files {
+		if err := os.MkdirAll(path.Join(folder, path.Dir(file)), os.ModePerm); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path.Join(folder, file), []byte(data), os.ModePerm); err != nil {
+			t.Fatal(err)
+		}
+	}
+	interval := 50 * time.Millisecond
+	site := New(Options{Root: folder, Jobs: 4, External: true, Interval: interval, Log: io.Discard})
+	times := []time.Time{}
+	site.wait = func(until time.Time) {
+		mutex.Lock()
+		times = append(times, until)
+		mutex.Unlock()
+	}
+	if err := site.Load(); err != nil {
+		t.Fatal(err)
+	}
+	if err := site.Build(); err != nil {
+		t.Fatal(err)
+	}
+	links, err := site.Check()
+	if err != nil {
+		t.Fatal(err)
+	}
+	found := make(map[string]Link)
+	for _, link := range links {
+		found[link.URL] = link
+	}
+	if len(found) != 2 {
+		t.Fatalf("expected 2 links, got %v", links)
+	}
+	if link := found[server.URL+"/missing"]; link.Status != 404 || !link.Broken() {
+		t.Errorf("expected broken 404 for /missing, got %+v", link)
+	}
+	link := found[server.URL+"/a"]
+	if link.Status != 200 || link.Broken() || !slices.Equal(link.Redirects, []string{server.URL + "/b", server.URL + "/c"}) {
+		t.Errorf("expected /a to redirect to /b and /c, got %+v", link)
+	}
+
+	data, err := os.ReadFile(path.Join(folder, ".cache/links.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	cache := make(map[string]result)
+	if err := json.Unmarshal(data, &cache); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"/ok", "/head"} {
+		if entry := cache[server.URL+name]; entry.Status != 200 || len(entry.Error) > 0 {
+			t.Errorf("expected 200 for %s, got %+v", name, entry)
+		}
+	}
+	if hits["HEAD /head"] != 1 || hits["GET /head"] != 1 {
+		t.Errorf("expected HEAD and GET for /head, got %v", hits)
+	}
+
+	requests := 0
+	for _, value := range hits {
+		requests += value
+	}
+	if len(times) != requests {
+		t.Errorf("expected a wait for each of the %d requests, got %d", requests, len(times))
+	}
+	slices.SortFunc(times, func(a time.Time, b time.Time) int {
+		return a.Compare(b)
+	})
+	for index := 1; index < len(times); index++ {
+		if delta := times[index].Sub(times[index-1]); delta < interval {
+			t.Errorf("expected requests to be %v apart, got %v", interval, delta)
+		}
+	}
+
+	before := make(map[string]int)
+	for key, value := range hits {
+		before[key] = value
+	}
+	if _, err := site.Check(); err != nil {
+		t.Fatal(err)
+	}
+	for key, value := range hits {
+		expected := before[key]
+		if key == "HEAD /missing" || key == "GET /missing" {
+			expected++
+		}
+		if value != expected {
+			t.Errorf("expected %d requests for %s, got %d", expected, key, value)
+		}
+	}
+}
@@ -0,0 +1,3 @@
+module github.com/lutzroeder/minimal
+
+go 1.22
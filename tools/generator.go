@@ -2,671 +2,603 @@ package main
 
 import (
 	"bytes"
-	"encoding/json"
+	"flag"
 	"fmt"
 	"io"
+	"mime"
+	"net"
 	"net/http"
 	"os"
+	"os/exec"
 	"path"
 	"regexp"
 	"runtime"
+	"slices"
 	"sort"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
-)
-
-var configuration map[string]interface{}
-var environment string
-var destination = "build"
-var theme = "default"
 
-var entityMap = strings.NewReplacer(
-	`&`, "&amp;", `<`, "&lt;", `>`, "&gt;", `"`, "&quot;", `'`, "&#39;", `/`, "&#x2F;", "`", "&#x60;", `=`, "&#x3D;",
+	"github.com/lutzroeder/minimal/generator"
 )
 
-func escapeHTML(text string) string {
-	return entityMap.Replace(text)
-}
-
-func merge(maps ...map[string]interface{}) map[string]interface{} {
-	target := make(map[string]interface{})
-	for _, obj := range maps {
-		for key, value := range obj {
-			target[key] = value
-		}
+func writeString(response http.ResponseWriter, request *http.Request, statusCode int, contentType string, text string) {
+	response.Header().Set("Content-Type", contentType)
+	response.Header().Set("Content-Length", strconv.Itoa(bytes.NewBufferString(text).Len()))
+	response.WriteHeader(statusCode)
+	if request.Method != "HEAD" {
+		io.WriteString(response, text)
 	}
-	return target
 }
 
-var sectionRegex = regexp.MustCompile("{{#\\s*([-_\\/\\.\\w]+)\\s*}}\\s?")
-var partialRegex = regexp.MustCompile("{{>\\s*([-_/.\\w]+)\\s*}}")
-var replaceRegex = regexp.MustCompile("{{{\\s*([-_/.\\w]+)\\s*}}}")
-var escapeRegex = regexp.MustCompile("{{\\s*([-_/.\\w]+)\\s*}}")
-
-func mustache(template string, view map[string]interface{}, partials func(string) string) string {
-	for index := 0; index < len(template); {
-		if match := sectionRegex.FindStringIndex(template[index:]); match != nil {
-			name := sectionRegex.FindStringSubmatch(template[index+match[0] : index+match[1]])[1]
-			start := index + match[0]
-			index += match[1]
-			if match := regexp.MustCompile("{{\\/\\s*" + name + "\\s*}}\\s?").FindStringIndex(template[index:]); match != nil {
-				content := template[index : index+match[0]]
-				if value, ok := view[name]; ok {
-					switch value := value.(type) {
-					case []interface{}:
-						output := make([]string, len(value))
-						for index, item := range value {
-							context := merge(view, item.(map[string]interface{}))
-							output[index] = mustache(content, context, partials)
-						}
-						content = strings.Join(output, "")
-					case bool:
-						if !value {
-							content = ""
-						}
-					case string:
-						if value == "" {
-							content = ""
+func modified(files ...string) map[string]time.Time {
+	items := make(map[string]time.Time)
+	for _, file := range files {
+		if stat, err := os.Stat(file); err == nil {
+			if stat.IsDir() {
+				entries, _ := os.ReadDir(file)
+				for _, entry := range entries {
+					if !strings.HasPrefix(entry.Name(), ".") {
+						for key, value := range modified(path.Join(file, entry.Name())) {
+							items[key] = value
 						}
 					}
-				} else {
-					content = ""
 				}
-				template = template[0:start] + content + template[index+match[1]:]
-				index = start
+			} else {
+				items[file] = stat.ModTime()
 			}
-		} else {
-			index = len(template)
 		}
 	}
-	template = partialRegex.ReplaceAllStringFunc(template, func(match string) string {
-		name := partialRegex.FindStringSubmatch(match)[1]
-		return mustache(partials(name), view, partials)
-	})
-	template = replaceRegex.ReplaceAllStringFunc(template, func(match string) string {
-		name := replaceRegex.FindStringSubmatch(match)[1]
-		if value, ok := view[name]; ok {
-			switch value := value.(type) {
-			case func() string:
-				return mustache(value(), view, partials)
-			case string:
-				return mustache(value, view, partials)
+	return items
+}
+
+func poll(files []string, callback func(changes []string)) {
+	current := modified(files...)
+	for {
+		time.Sleep(300 * time.Millisecond)
+		changes := make(map[string]bool)
+		for {
+			next := modified(files...)
+			found := false
+			for file, value := range next {
+				if previous, ok := current[file]; !ok || !previous.Equal(value) {
+					changes[file] = true
+					found = true
+				}
+			}
+			for file := range current {
+				if _, ok := next[file]; !ok {
+					changes[file] = true
+					found = true
+				}
 			}
+			current = next
+			if !found {
+				break
+			}
+			time.Sleep(200 * time.Millisecond)
 		}
-		return match
-	})
-	template = escapeRegex.ReplaceAllStringFunc(template, func(match string) string {
-		name := escapeRegex.FindStringSubmatch(match)[1]
-		if value, ok := view[name]; ok {
-			switch value := value.(type) {
-			case func() string:
-				return escapeHTML(value())
-			case string:
-				return escapeHTML(value)
+		if len(changes) > 0 {
+			list := make([]string, 0, len(changes))
+			for file := range changes {
+				list = append(list, file)
 			}
+			sort.Strings(list)
+			callback(list)
 		}
-		return match
-	})
-	return template
+	}
 }
 
-func host(request *http.Request) string {
-	if host, ok := configuration["host"]; ok {
-		return host.(string)
+var sources = []string{"content.json", "content/", "themes/", "data/", "redirect.map"}
+
+func sentence(err error) string {
+	text := err.Error()
+	if len(text) == 0 {
+		return "Unknown error."
 	}
-	scheme := "http"
-	if value := request.Header.Get("x-forwarded-proto"); len(value) > 0 {
-		scheme = value
+	if word, _, _ := strings.Cut(text, " "); !strings.ContainsAny(word, "/:") {
+		text = strings.ToUpper(text[:1]) + text[1:]
 	}
-	if value := request.Header.Get("x-forwarded-protocol"); len(value) > 0 {
-		scheme = value
+	if !strings.HasSuffix(text, ".") {
+		text += "."
 	}
-	return scheme + "://" + request.Host
+	return text
 }
 
-func formatDate(date time.Time, format string) string {
-	switch format {
-	case "atom":
-		return date.UTC().Format("2006-01-02T15:04:05Z")
-	case "rss":
-		return date.UTC().Format("Mon, 02 Jan 2006 15:04:05 +0000")
-	case "user":
-		return date.Format("Jan 2, 2006")
-	}
-	return ""
+func watch(build func() error) {
+	rebuild := func() {
+		start := time.Now()
+		if err := build(); err != nil {
+			fmt.Println(sentence(err))
+			return
+		}
+		fmt.Println("Built in " + time.Since(start).Round(time.Millisecond).String() + ".")
+	}
+	rebuild()
+	go poll(sources, func(changes []string) {
+		rebuild()
+	})
 }
 
-var tagRegexp = regexp.MustCompile("<(\\w+)[^>]*>")
-var entityRegexp = regexp.MustCompile("(#?[A-Za-z0-9]+;)")
-var truncateMap = map[string]bool{
-	"pre": true, "code": true, "img": true, "table": true, "style": true, "script": true, "h2": true, "h3": true,
+type redirect struct {
+	source string
+	target string
 }
 
-func truncate(text string, length int) string {
-	closeTags := make(map[int]string)
-	ellipsis := ""
-	count := 0
-	index := 0
-	for count < length && index < len(text) {
-		if text[index] == '<' {
-			if closeTag, ok := closeTags[index]; ok {
-				delete(closeTags, index)
-				index += len(closeTag)
-			} else {
-				match := tagRegexp.FindStringSubmatch(text[index:])
-				if len(match) > 0 {
-					tag := strings.ToLower(match[1])
-					if value, ok := truncateMap[tag]; ok && value {
-						break
-					}
-					index += len(match[0])
-					if match := regexp.MustCompile("(?i)</" + tag + "\\s*>").FindStringIndex(text[index:]); match != nil {
-						closeTags[index+match[0]] = "</" + tag + ">"
-					}
-				} else {
-					index++
-					count++
-				}
-			}
-		} else if text[index] == '&' {
-			index++
-			if entity := entityRegexp.FindString(text[index:]); len(entity) > 0 {
-				index += len(entity)
-			}
-			count++
-		} else {
-			if text[index] == ' ' {
-				index++
-				count++
-			}
-			skip := strings.IndexAny(text[index:], " <&")
-			if skip == -1 {
-				skip = len(text) - index
-			}
-			if count+skip >= length {
-				ellipsis = "&hellip;"
-			}
-			if count+skip-15 > length {
-				skip = length - count
+type server struct {
+	folder       string
+	indexPage    string
+	notFoundPage string
+	redirects    []redirect
+	liveReload   bool
+	render       func(request *http.Request) (int, map[string]string, []byte)
+	clients      map[chan string]bool
+	mutex        sync.Mutex
+}
+
+const liveReloadPath = "/_live-reload"
+const liveReloadScript = `<script type="text/javascript">
+(function () {
+    var source = new EventSource("` + liveReloadPath + `");
+    source.addEventListener("css", function () {
+        var links = document.querySelectorAll("link[rel=stylesheet]");
+        for (var i = 0; i < links.length; i++) {
+            if (links[i].href.indexOf(window.location.origin + "/") == 0) {
+                var url = links[i].href.replace(/[?&]reload=\d+$/, "");
+                links[i].href = url + (url.indexOf("?") == -1 ? "?" : "&") + "reload=" + Date.now();
+            }
+        }
+    });
+    source.addEventListener("reload", function () {
+        window.location.reload();
+    });
+})();
+</script>
+`
+
+func loadRedirects(file string) []redirect {
+	redirects := []redirect{}
+	if data, err := os.ReadFile(file); err == nil {
+		for _, line := range regexp.MustCompile("\\r\\n?|\\n").Split(string(data), -1) {
+			if fields := strings.Fields(line); len(fields) > 1 {
+				redirects = append(redirects, redirect{source: fields[0], target: fields[1]})
 			}
-			index += skip
-			count += skip
 		}
 	}
-	output := []string{}
-	output = append(output, text[0:index])
-	if len(ellipsis) > 0 {
-		output = append(output, ellipsis)
+	return redirects
+}
+
+func (server *server) ServeHTTP(response http.ResponseWriter, request *http.Request) {
+	if server.liveReload && request.URL.Path == liveReloadPath {
+		server.events(response, request)
+		return
 	}
-	keys := []int{}
-	for key := range closeTags {
-		keys = append(keys, key)
+	statusCode := 0
+	headers := map[string]string{}
+	buffer := []byte{}
+	for _, redirect := range server.redirects {
+		if redirect.source == request.URL.Path {
+			statusCode = 301
+			headers["Location"] = redirect.target
+			break
+		}
+	}
+	if statusCode == 0 && server.render != nil {
+		statusCode, headers, buffer = server.render(request)
+	} else if statusCode == 0 {
+		statusCode, headers, buffer = server.file(request)
 	}
-	sort.Sort(sort.IntSlice(keys))
-	for _, key := range keys {
-		if closeTag, ok := closeTags[key]; ok {
-			output = append(output, closeTag)
+	fmt.Println(strconv.Itoa(statusCode) + " " + request.Method + " " + request.RequestURI)
+	if server.liveReload && strings.HasPrefix(headers["Content-Type"], "text/html") {
+		text := string(buffer)
+		if index := strings.LastIndex(strings.ToLower(text), "</body>"); index != -1 {
+			text = text[0:index] + liveReloadScript + text[index:]
+		} else {
+			text += liveReloadScript
 		}
+		buffer = []byte(text)
 	}
-	return strings.Join(output, "")
+	for key, value := range headers {
+		response.Header().Set(key, value)
+	}
+	writeString(response, request, statusCode, headers["Content-Type"], string(buffer))
 }
 
-func posts() []string {
-	folders := []string{}
-	items, _ := os.ReadDir("content/blog/")
-	for i := len(items) - 1; i >= 0; i-- {
-		item := items[i]
-		if item.IsDir() {
-			post := item.Name()
-			if _, err := os.Stat("content/blog/" + post + "/index.md"); !os.IsNotExist(err) {
-				folders = append(folders, post)
-			}
+func (server *server) file(request *http.Request) (int, map[string]string, []byte) {
+	pathname := path.Clean("/" + request.URL.Path)
+	if strings.HasSuffix(request.URL.Path, "/") && pathname != "/" {
+		pathname += "/"
+	}
+	location := server.folder + pathname
+	if stat, err := os.Stat(location); err == nil && stat.IsDir() {
+		if !strings.HasSuffix(location, "/") {
+			return 302, map[string]string{"Location": pathname + "/"}, nil
 		}
+		location += server.indexPage
 	}
-	return folders
+	statusCode := 200
+	if stat, err := os.Stat(location); err != nil || stat.IsDir() {
+		statusCode = 404
+		location = server.folder + "/" + server.notFoundPage
+	}
+	data, err := os.ReadFile(location)
+	if err != nil {
+		return 404, map[string]string{"Content-Type": "text/plain; charset=utf-8"}, []byte("404")
+	}
+	return statusCode, map[string]string{"Content-Type": mime.TypeByExtension(path.Ext(location))}, data
 }
 
-var htmlBlockTags = []string{"<style", "<script", "<svg", "<p"}
-
-func markdown(s string) string {
-	lines := strings.Split(s, "\n")
-	var out []string
-	var para []string
-	var codeLines []string
-	inCode := false
-	inHTML := ""
-	flushPara := func() {
-		if len(para) == 0 {
-			return
-		}
-		text := strings.Join(para, "\n")
-		text = inlineMarkdown(text)
-		out = append(out, "<p>"+text+"</p>")
-		para = nil
+func (server *server) events(response http.ResponseWriter, request *http.Request) {
+	flusher, ok := response.(http.Flusher)
+	if !ok {
+		response.WriteHeader(500)
+		return
 	}
-	for _, line := range lines {
-		if inHTML != "" {
-			out = append(out, line)
-			if strings.Contains(line, "</"+inHTML+">") || strings.Contains(line, "<"+inHTML+"/>") || strings.Contains(line, "<"+inHTML+" />") {
-				inHTML = ""
-			}
-			continue
-		}
-		if strings.HasPrefix(line, "```") {
-			if !inCode {
-				flushPara()
-				inCode = true
-				codeLines = nil
-			} else {
-				inCode = false
-				code := strings.Join(codeLines, "\n")
-				code = mdBold.ReplaceAllString(code, `<b>$1</b>`)
-				out = append(out, "<pre>"+code+"</pre>")
-			}
-			continue
-		}
-		if inCode {
-			codeLines = append(codeLines, line)
-			continue
-		}
-		trimmed := strings.TrimSpace(line)
-		if trimmed == "" {
-			flushPara()
-			continue
-		}
-		if strings.HasPrefix(trimmed, "<") {
-			flushPara()
-			for _, tag := range htmlBlockTags {
-				if strings.HasPrefix(strings.ToLower(trimmed), tag) {
-					name := tag[1:]
-					if !strings.Contains(line, "</"+name+">") && !strings.Contains(line, "<"+name+"/>") && !strings.Contains(line, "<"+name+" />") {
-						inHTML = name
-					}
-					break
-				}
-			}
-			out = append(out, line)
-			continue
-		}
-		if strings.HasPrefix(trimmed, "### ") {
-			flushPara()
-			out = append(out, "<h3>"+inlineMarkdown(strings.TrimPrefix(trimmed, "### "))+"</h3>")
-			continue
-		}
-		if strings.HasPrefix(trimmed, "## ") {
-			flushPara()
-			out = append(out, "<h2>"+inlineMarkdown(strings.TrimPrefix(trimmed, "## "))+"</h2>")
-			continue
+	events := make(chan string, 1)
+	server.mutex.Lock()
+	server.clients[events] = true
+	server.mutex.Unlock()
+	defer func() {
+		server.mutex.Lock()
+		delete(server.clients, events)
+		server.mutex.Unlock()
+	}()
+	response.Header().Set("Content-Type", "text/event-stream")
+	response.Header().Set("Cache-Control", "no-cache")
+	response.WriteHeader(200)
+	flusher.Flush()
+	for {
+		select {
+		case event := <-events:
+			fmt.Fprintf(response, "event: %s\ndata: %s\n\n", event, event)
+			flusher.Flush()
+		case <-request.Context().Done():
+			return
 		}
-		para = append(para, line)
 	}
-	flushPara()
-	return strings.Join(out, "\n")
 }
 
-var mdImage = regexp.MustCompile(`!\[([^\]]*)\]\(([^)]+)\)`)
-var mdLink = regexp.MustCompile(`\[([^\]]+)\]\(([^)]+)\)`)
-var mdBold = regexp.MustCompile(`\*\*(.+?)\*\*`)
-var mdItalic = regexp.MustCompile(`(?:^|[^*])\*([^*]+?)\*(?:[^*]|$)`)
-var mdCode = regexp.MustCompile("`([^`]+)`")
-
-func inlineMarkdown(s string) string {
-	// Code first to protect from other replacements
-	var codes []string
-	s = mdCode.ReplaceAllStringFunc(s, func(m string) string {
-		code := mdCode.FindStringSubmatch(m)[1]
-		placeholder := fmt.Sprintf("\x00CODE%d\x00", len(codes))
-		codes = append(codes, "<code>"+escapeHTML(code)+"</code>")
-		return placeholder
-	})
-	s = mdImage.ReplaceAllString(s, `<img alt="$1" src="$2">`)
-	s = mdLink.ReplaceAllString(s, `<a href="$2">$1</a>`)
-	s = mdBold.ReplaceAllString(s, `<b>$1</b>`)
-	s = mdItalic.ReplaceAllStringFunc(s, func(m string) string {
-		sub := mdItalic.FindStringSubmatch(m)
-		prefix := ""
-		suffix := ""
-		if len(m) > 0 && m[0] != '*' {
-			prefix = string(m[0])
-		}
-		if len(m) > 0 && m[len(m)-1] != '*' {
-			suffix = string(m[len(m)-1])
-		}
-		return prefix + "<i>" + sub[1] + "</i>" + suffix
-	})
-	// Restore code placeholders
-	for i, code := range codes {
-		s = strings.Replace(s, fmt.Sprintf("\x00CODE%d\x00", i), code, 1)
+func (server *server) broadcast(event string) {
+	server.mutex.Lock()
+	defer server.mutex.Unlock()
+	for events := range server.clients {
+		select {
+		case events <- event:
+		default:
+		}
 	}
-	return s
 }
 
-func loadPost(path string) map[string]interface{} {
-	if stat, err := os.Stat(path); !os.IsNotExist(err) && !stat.IsDir() {
-		data, err := os.ReadFile(path)
-		if err != nil {
-			fmt.Println(err)
-		} else {
-			item := make(map[string]interface{})
-			content := []string{}
-			metadata := -1
-			lines := regexp.MustCompile("\\r\\n?|\\n").Split(string(data), -1)
-			for len(lines) > 0 {
-				line := lines[0]
-				lines = lines[1:]
-				if strings.HasPrefix(line, "---") {
-					metadata++
-				} else if metadata == 0 {
-					index := strings.Index(line, ":")
-					if index >= 0 {
-						name := strings.Trim(strings.Trim(line[0:index], " "), "\"")
-						value := strings.Trim(strings.Trim(line[index+1:], " "), "\"")
-						item[name] = value
-					}
-				} else {
-					content = append(content, line)
+func (server *server) listen(port string, browse bool) error {
+	listener, err := net.Listen("tcp", ":"+port)
+	if err != nil {
+		return err
+	}
+	if server.liveReload {
+		files := []string{server.folder}
+		if server.render != nil {
+			files = sources
+		}
+		go poll(files, func(changes []string) {
+			event := "css"
+			for _, file := range changes {
+				if path.Ext(file) != ".css" || server.render != nil {
+					event = "reload"
 				}
 			}
-			body := strings.Join(content, "\n")
-			if strings.HasSuffix(path, ".md") {
-				body = markdown(body)
-			}
-			item["content"] = body
-			return item
+			server.broadcast(event)
+		})
+	}
+	url := "http://localhost:" + port
+	if server.render != nil {
+		fmt.Println("Serving 'content/' at " + url + "...")
+	} else {
+		fmt.Println("Serving '" + server.folder + "' at " + url + "...")
+	}
+	if browse {
+		command := "xdg-open"
+		arguments := []string{url}
+		switch runtime.GOOS {
+		case "darwin":
+			command = "open"
+		case "windows":
+			command = "cmd"
+			arguments = []string{"/C", "start", url}
 		}
+		exec.Command(command, arguments...).Start()
 	}
-	return nil
+	return http.Serve(listener, server)
 }
 
-func renderBlog(folders []string, destination string, root string, page int) string {
-	items := make([]interface{}, 0)
-	view := make(map[string]interface{})
-	count := 10
-	for count > 0 && len(folders) > 0 {
-		folder := folders[0]
-		folders = folders[1:]
-		item := loadPost("content/blog/" + folder + "/index.md")
-		if item != nil && (item["state"] == "post" || environment != "production") {
-			item["url"] = "blog/" + folder + "/"
-			if _, ok := item["date"]; ok {
-				if date, e := time.Parse("2006-01-02 15:04:05 -07:00", item["date"].(string)); e == nil {
-					item["date"] = formatDate(date, "user")
-				}
+func loadDefaults(file string) map[string]string {
+	defaults := make(map[string]string)
+	if data, err := os.ReadFile(file); err == nil {
+		for _, line := range regexp.MustCompile("\\r\\n?|\\n").Split(string(data), -1) {
+			line = strings.TrimSpace(line)
+			if index := strings.Index(line, "="); index > 0 && !strings.HasPrefix(line, "#") {
+				defaults[strings.TrimSpace(line[0:index])] = strings.Trim(strings.TrimSpace(line[index+1:]), "\"'")
 			}
-			content := item["content"].(string)
-			content = regexp.MustCompile("\\s\\s").ReplaceAllString(content, " ")
-			truncated := truncate(content, 250)
-			item["content"] = truncated
-			item["more"] = truncated != content
-			items = append(items, item)
-			count--
-		}
-	}
-	view["items"] = items
-	placeholder := make([]interface{}, 0)
-	if len(folders) > 0 {
-		page++
-		location := "blog/page" + strconv.Itoa(page) + ".html"
-		placeholder = append(placeholder, map[string]interface{}{"url": root + "../" + location})
-		file := destination + "/" + location
-		data := renderBlog(folders, destination, root, page)
-		os.WriteFile(file, []byte(data), os.ModePerm)
-	}
-	view["placeholder"] = placeholder
-	view["root"] = root
-	template, err := os.ReadFile(path.Join("themes/" + theme + "/feed.html"))
-	if err != nil {
-		fmt.Println(err)
-		return ""
+		}
 	}
-	return mustache(string(template), view, nil)
+	return defaults
 }
 
-func writeString(response http.ResponseWriter, request *http.Request, contentType string, text string) {
-	response.Header().Set("Content-Type", contentType)
-	response.Header().Set("Content-Length", strconv.Itoa(bytes.NewBufferString(text).Len()))
-	if request.Method != "HEAD" {
-		io.WriteString(response, text)
-	}
+type options struct {
+	output       string
+	theme        string
+	target       string
+	port         string
+	indexPage    string
+	notFoundPage string
+	redirectMap  string
+	jobs         int
+	sites        bool
+	strict       bool
+	external     bool
+	render       bool
+	liveReload   bool
+	browse       bool
+	environment  string
 }
 
-func renderPost(source string, destination string, root string) bool {
-	if strings.HasPrefix(source, "content/blog/") && strings.HasSuffix(source, "/index.md") {
-		item := loadPost(source)
-		if item != nil {
-			if updated, ok := item["updated"]; ok {
-				if date, ok := item["date"]; !ok || date == updated {
-					delete(item, "updated")
-				} else if date, e := time.Parse("2006-01-02 15:04:05 -07:00", updated.(string)); e == nil {
-					item["updated"] = formatDate(date, "user")
-				}
-			}
-			if _, ok := item["date"]; ok {
-				if date, e := time.Parse("2006-01-02 15:04:05 -07:00", item["date"].(string)); e == nil {
-					item["date"] = formatDate(date, "user")
-				}
-			}
-			if _, ok := item["author"]; !ok {
-				item["author"] = configuration["name"].(string)
-			}
-			view := merge(configuration, item)
-			view["root"] = root
-			template, err := os.ReadFile("themes/" + theme + "/post.html")
-			if err != nil {
-				fmt.Println(err)
-			} else {
-				data := mustache(string(template), view, func(name string) string {
-					data, err := os.ReadFile("themes/" + theme + "/" + name)
-					if err != nil {
-						fmt.Println(err)
-						return ""
-					}
-					return string(data)
-				})
-				os.WriteFile(destination, []byte(data), os.ModePerm)
-				return true
-			}
-		}
-	}
-	return false
+type command struct {
+	name        string
+	arguments   string
+	description string
+	flags       []string
 }
 
-func renderFile(source string, destination string) {
-	data, err := os.ReadFile(source)
-	if err == nil {
-		err = os.WriteFile(destination, data, os.ModePerm)
-	}
-	if err != nil {
-		fmt.Println(err)
-	}
+var commands = []command{
+	{"build", "[output]", "Build the website", []string{"theme", "sites", "jobs", "strict"}},
+	{"serve", "[output]", "Serve the website from the output folder, or render it on demand", []string{"theme", "port", "index-page", "not-found-page", "redirect-map", "render", "live-reload", "browse"}},
+	{"watch", "[output]", "Build and serve the website, and rebuild when sources change", []string{"theme", "jobs", "port", "index-page", "not-found-page", "redirect-map", "browse"}},
+	{"new", "<kind> <title>", "Create new content", []string{}},
+	{"check", "[output]", "Build the website and check it for broken links", []string{"theme", "sites", "jobs", "strict", "external"}},
+	{"deploy", "[arguments]", "Build the website and deploy it to the target", []string{"theme", "sites", "jobs", "strict", "target"}},
 }
 
-func renderFeed(source string, destination string) {
-	host := configuration["host"].(string)
-	format := strings.TrimPrefix(path.Ext(source), ".")
-	count := 10
-	items := make([]interface{}, 0)
-	feed := map[string]interface{}{
-		"name":        configuration["name"],
-		"description": configuration["description"],
-		"author":      configuration["name"],
-		"url":         configuration["feeds"].([]interface{})[0].(map[string]interface{})["url"].(string),
-		"host":        host,
-	}
-	recentFound := false
-	recent := time.Now()
-	folders := posts()
-	for len(folders) > 0 && count > 0 {
-		folder := folders[0]
-		folders = folders[1:]
-		item := loadPost("content/blog/" + folder + "/index.md")
-		if item != nil && (item["state"] == "post" || environment != "production") {
-			item["url"] = host + "/blog/" + folder + "/"
-			if author, ok := item["author"]; !ok || author.(string) == configuration["name"].(string) {
-				item["author"] = false
-			}
-			if _, ok := item["date"]; ok {
-				if date, err := time.Parse("2006-01-02 15:04:05 -07:00", item["date"].(string)); err == nil {
-					updated := date
-					if _, ok := item["updated"]; ok {
-						if temp, err := time.Parse("2006-01-02 15:04:05 -07:00", item["updated"].(string)); err == nil {
-							updated = temp
-						}
-					}
-					item["date"] = formatDate(date, format)
-					item["updated"] = formatDate(updated, format)
-					if !recentFound || recent.Before(updated) {
-						recent = updated
-						recentFound = true
-					}
+func usage() {
+	fmt.Println("Usage: go run tools/generator.go <command> [options]")
+	fmt.Println()
+	for _, command := range commands {
+		fmt.Printf("    %-8s %s\n", command.name, command.description)
+	}
+	fmt.Println()
+	fmt.Println("Run 'go run tools/generator.go <command> --help' for the options of a command.")
+}
+
+func parseArguments(name string, args []string, options *options) ([]string, error) {
+	set := flag.NewFlagSet(name, flag.ContinueOnError)
+	set.SetOutput(os.Stdout)
+	set.StringVar(&options.output, "output", options.output, "output `folder`")
+	for _, command := range commands {
+		if command.name == name {
+			for _, option := range command.flags {
+				switch option {
+				case "theme":
+					set.StringVar(&options.theme, option, options.theme, "theme `name`, defaults to the theme in content.json")
+				case "sites":
+					set.BoolVar(&options.sites, option, options.sites, "build all site variants in content.json")
+				case "strict":
+					set.BoolVar(&options.strict, option, options.strict, "fail the build on broken links")
+				case "external":
+					set.BoolVar(&options.external, option, options.external, "also check outbound links in posts")
+				case "jobs":
+					set.IntVar(&options.jobs, option, options.jobs, "`number` of parallel render jobs")
+				case "port":
+					set.StringVar(&options.port, option, options.port, "HTTP `port`")
+				case "index-page":
+					set.StringVar(&options.indexPage, option, options.indexPage, "`file` served for folders")
+				case "not-found-page":
+					set.StringVar(&options.notFoundPage, option, options.notFoundPage, "`file` served for missing pages")
+				case "redirect-map":
+					set.StringVar(&options.redirectMap, option, options.redirectMap, "redirect map `file`, defaults to redirect.map in the output folder")
+				case "render":
+					set.BoolVar(&options.render, option, options.render, "render pages on demand from content/ and themes/")
+				case "live-reload":
+					set.BoolVar(&options.liveReload, option, options.liveReload, "reload pages when files change")
+				case "browse":
+					set.BoolVar(&options.browse, option, options.browse, "open the website in a browser")
+				case "target":
+					set.StringVar(&options.target, option, options.target, "deploy `target` in deploy/")
 				}
 			}
-			item["content"] = escapeHTML(item["content"].(string))
-			items = append(items, item)
-			count--
+			set.Usage = func() {
+				fmt.Println("Usage: go run tools/generator.go " + command.name + " " + command.arguments + " [options]")
+				fmt.Println()
+				fmt.Println(command.description + ".")
+				fmt.Println()
+				set.PrintDefaults()
+			}
 		}
 	}
-	feed["updated"] = formatDate(recent, format)
-	feed["items"] = items
-	template, err := os.ReadFile(source)
-	if err != nil {
-		fmt.Println(err)
-	} else {
-		data := mustache(string(template), feed, nil)
-		os.WriteFile(destination, []byte(data), os.ModePerm)
+	positional := []string{}
+	for {
+		if err := set.Parse(args); err != nil {
+			return nil, err
+		}
+		args = set.Args()
+		if len(args) == 0 {
+			break
+		}
+		positional = append(positional, args[0])
+		args = args[1:]
+	}
+	if options.jobs < 1 {
+		return nil, fmt.Errorf("invalid value '%d' for '--jobs'", options.jobs)
 	}
+	return positional, nil
 }
 
-func renderPage(source string, destination string, root string) {
-	if renderPost(source, destination, root) {
-		return
+func run(args []string) int {
+	if len(args) == 0 || args[0] == "--help" || args[0] == "-h" || args[0] == "help" {
+		usage()
+		if len(args) == 0 {
+			return 2
+		}
+		return 0
+	}
+	name := args[0]
+	if !slices.ContainsFunc(commands, func(command command) bool { return command.name == name }) {
+		fmt.Println("Unknown command '" + name + "'.")
+		usage()
+		return 2
+	}
+	defaults := loadDefaults("task.cfg")
+	options := &options{
+		output:       defaults["output"],
+		target:       defaults["target"],
+		port:         "8080",
+		indexPage:    "index.html",
+		notFoundPage: "404.html",
+		jobs:         runtime.NumCPU(),
+		environment:  os.Getenv("ENVIRONMENT"),
+	}
+	if len(options.output) == 0 {
+		options.output = "build"
+	}
+	positional, err := parseArguments(name, args[1:], options)
+	if err == flag.ErrHelp {
+		return 0
 	}
-	template, err := os.ReadFile(source)
 	if err != nil {
-		fmt.Println(err)
-	} else {
-		view := merge(configuration)
-		view["root"] = root
-		view["blog"] = func() string {
-			return renderBlog(posts(), path.Dir(destination), root, 0) +
-				`<script type="text/javascript">
-function updateStream() {
-    var element = document.getElementById("stream");
-    if (element) {
-      var rect = element.getBoundingClientRect();
-      var threshold = 0;
-      if (rect.bottom > threshold && (window.innerHeight - rect.top) > threshold) {
-        var url = element.getAttribute("title");
-        var xmlHttp = new XMLHttpRequest();
-        xmlHttp.open("GET", url, true);
-        xmlHttp.onreadystatechange = function () {
-            if (xmlHttp.readyState == 4 && xmlHttp.status == 200) {
-                element.insertAdjacentHTML('beforebegin', xmlHttp.responseText);
-                element.parentNode.removeChild(element);
-                updateStream();
-            }
-        };
-        xmlHttp.send(null);
-      }
-    }
-}
-updateStream();
-window.addEventListener('scroll', function(e) {
-    updateStream();
-});
-</script>
-`
+		fmt.Println(sentence(err))
+		return 2
+	}
+	if name != "new" && name != "deploy" && len(positional) > 0 {
+		options.output = positional[0]
+		positional = positional[1:]
+	}
+	if name != "new" && name != "deploy" && len(positional) > 0 {
+		fmt.Println("Unexpected argument '" + positional[0] + "'.")
+		return 2
+	}
+	if len(options.environment) == 0 && (name == "serve" || name == "watch") {
+		options.environment = "development"
+	}
+	if name == "deploy" {
+		options.environment = "production"
+	}
+	site := generator.New(generator.Options{
+		Root:        ".",
+		Log:         os.Stdout,
+		Environment: options.environment,
+		Destination: options.output,
+		Theme:       options.theme,
+		Sites:       options.sites,
+		Jobs:        options.jobs,
+		External:    options.external,
+	})
+	build := func() error {
+		if err := site.Load(); err != nil {
+			return err
+		}
+		return site.Build()
+	}
+	check := func() error {
+		links, err := site.Check()
+		if err != nil {
+			return err
+		}
+		count := 0
+		for _, link := range links {
+			if link.Broken() {
+				count++
+				reason := link.Error
+				if len(reason) == 0 {
+					reason = strconv.Itoa(link.Status)
+				}
+				fmt.Println(link.Source + ": Broken link '" + link.URL + "' in '" + link.File + "' (" + reason + ").")
+			} else {
+				fmt.Println(link.Source + ": Link '" + link.URL + "' in '" + link.File + "' redirects to '" + strings.Join(link.Redirects, "' -> '") + "'.")
+			}
+		}
+		if count > 0 && options.strict {
+			return fmt.Errorf("found %d broken link(s)", count)
+		}
+		return nil
+	}
+	switch name {
+	case "build", "deploy":
+		fmt.Println("go " + strings.TrimPrefix(runtime.Version(), "go") + " " + options.environment)
+		if err := build(); err != nil {
+			fmt.Println(sentence(err))
+			return 1
 		}
-		pages := make([]interface{}, 0)
-		for _, item := range configuration["pages"].([]interface{}) {
-			page := item.(map[string]interface{})
-			location := path.Dir(source)
-			target := mustache(page["url"].(string), view, nil)
-			active := path.Join(location, target) == location
-			if visible, ok := page["visible"].(bool); (ok && visible) || active {
-				pages = append(pages, map[string]interface{}{"name": page["name"].(string), "url": page["url"].(string), "active": active})
+		if options.strict {
+			if err := check(); err != nil {
+				fmt.Println(sentence(err))
+				return 1
 			}
 		}
-		view["pages"] = pages
-		data := mustache(string(template), view, func(name string) string {
-			data, err := os.ReadFile("themes/" + theme + "/" + name)
-			if err != nil {
+		if name == "deploy" && len(options.target) > 0 {
+			process := exec.Command("deploy/"+options.target, append([]string{"deploy"}, positional...)...)
+			process.Stdin = os.Stdin
+			process.Stdout = os.Stdout
+			process.Stderr = os.Stderr
+			if err := process.Run(); err != nil {
 				fmt.Println(err)
+				if exit, ok := err.(*exec.ExitError); ok {
+					return exit.ExitCode()
+				}
+				return 1
 			}
-			return string(data)
-		})
-		os.WriteFile(destination, []byte(data), os.ModePerm)
-	}
-}
-
-func render(source string, destination string, root string) {
-	extension := path.Ext(source)
-	switch extension {
-	case ".rss", ".atom":
-		fmt.Println(destination)
-		renderFeed(source, destination)
-	case ".html":
-		fmt.Println(destination)
-		renderPage(source, destination, root)
-	case ".md":
-		destination = strings.TrimSuffix(destination, ".md") + ".html"
-		fmt.Println(destination)
-		renderPage(source, destination, root)
-	default:
-		renderFile(source, destination)
-	}
-}
-
-func renderDir(source string, destination string, root string) {
-	os.MkdirAll(destination, os.ModePerm)
-	location := source
-	if items, err := os.ReadDir(location); err == nil {
-		for _, item := range items {
-			name := item.Name()
-			if !strings.HasPrefix(name, ".") {
-				if item.IsDir() {
-					renderDir(source+name+"/", destination+"/"+name, root+"../")
-				} else {
-					render(source+name, destination+"/"+name, root)
+		}
+	case "serve", "watch":
+		server := &server{
+			folder:       options.output,
+			indexPage:    options.indexPage,
+			notFoundPage: options.notFoundPage,
+			liveReload:   options.liveReload || name == "watch",
+			clients:      make(map[chan string]bool),
+		}
+		if options.render && name == "serve" {
+			server.render = func(request *http.Request) (int, map[string]string, []byte) {
+				if err := site.Load(); err != nil {
+					fmt.Println(err)
+					return 500, map[string]string{"Content-Type": "text/plain; charset=utf-8"}, []byte(err.Error())
 				}
+				return site.Render(request)
 			}
 		}
-	}
-}
-
-func cleanDir(directory string) {
-	if items, err := os.ReadDir(directory); err == nil {
-		for _, item := range items {
-			os.RemoveAll(directory + "/" + item.Name())
+		if name == "watch" {
+			watch(build)
+		}
+		server.redirects = loadRedirects("redirect.map")
+		if len(options.redirectMap) > 0 {
+			server.redirects = loadRedirects(options.redirectMap)
+		} else if _, err := os.Stat(options.output + "/redirect.map"); err == nil && server.render == nil {
+			server.redirects = loadRedirects(options.output + "/redirect.map")
+		}
+		if err := server.listen(options.port, options.browse); err != nil {
+			fmt.Println(err)
+			return 1
+		}
+	case "new":
+		if len(positional) < 2 {
+			fmt.Println("Usage: go run tools/generator.go new <kind> <title>")
+			return 2
+		}
+		file, err := site.Create(positional[0], strings.Join(positional[1:], " "))
+		if err != nil {
+			fmt.Println(sentence(err))
+			return 1
+		}
+		fmt.Println(file)
+	case "check":
+		if err := build(); err != nil {
+			fmt.Println(sentence(err))
+			return 1
+		}
+		if err := check(); err != nil {
+			fmt.Println(sentence(err))
+			return 1
 		}
 	}
+	return 0
 }
 
 func main() {
-	environment = os.Getenv("ENVIRONMENT")
-	fmt.Println("go " + strings.TrimPrefix(runtime.Version(), "go") + " " + environment)
-	file, err := os.ReadFile("content.json")
-	if err != nil {
-		fmt.Println(err)
-		return
-	}
-	err = json.Unmarshal(file, &configuration)
-	if err != nil {
-		fmt.Println(err)
-		return
-	}
-	args := os.Args[1:]
-	for len(args) > 0 {
-		arg := args[0]
-		args = args[1:]
-		if arg == "--theme" && len(args) > 0 {
-			theme = args[0]
-			args = args[1:]
-		} else {
-			destination = arg
-		}
-	}
-	cleanDir(destination)
-	renderDir("content/", destination, "")
+	os.Exit(run(os.Args[1:]))
 }
@@ -227,20 +227,24 @@ const loadPost = (file) => {
             const item = {};
             const content = [];
             let metadata = -1;
+            let name = "";
             const lines = data.split(/\r\n?|\n/g);
             while (lines.length > 0) {
                 const line = lines.shift();
                 if (line.startsWith("---")) {
                     metadata++;
                 } else if (metadata === 0) {
+                    const trimmed = line.trim();
                     const index = line.indexOf(":");
-                    if (index >= 0) {
-                        const name = line.slice(0, index).trim();
+                    if (Array.isArray(item[name]) && trimmed.startsWith("- ")) {
+                        item[name].push(trimmed.slice(2).trim().replace(/^"|"$/g, ""));
+                    } else if (index >= 0) {
+                        name = line.slice(0, index).trim();
                         let value = line.slice(index + 1).trim();
                         if (value.startsWith('"') && value.endsWith('"')) {
                             value = value.slice(1, -1);
                         }
-                        item[name] = value;
+                        item[name] = value === "" && lines.length > 0 && lines[0].trim().startsWith("- ") ? [] : value;
                     }
                 } else {
                     content.push(line);
@@ -256,6 +260,113 @@ const loadPost = (file) => {
     return null;
 };
 
+const unescapeHtml = (text) => {
+    const entities = { "amp": "&", "lt": "<", "gt": ">", "quot": '"', "apos": "'", "nbsp": "\u00a0", "hellip": "\u2026" };
+    return text.replace(/&(#x[0-9a-fA-F]+|#[0-9]+|[A-Za-z]+);/g, (match, name) => {
+        if (name.startsWith("#x")) {
+            return String.fromCodePoint(parseInt(name.substring(2), 16));
+        }
+        if (name.startsWith("#")) {
+            return String.fromCodePoint(parseInt(name.substring(1), 10));
+        }
+        return name in entities ? entities[name] : match;
+    });
+};
+
+const plainText = (text) => {
+    return unescapeHtml(text.replace(/<[^>]*>/g, " ")).split(/\s+/).filter((word) => word.length > 0).join(" ");
+};
+
+const excerpt = (item) => {
+    if (item.summary) {
+        return [markdown(item.summary), true];
+    }
+    const match = item.content.match(/<!--\s*more\s*-->/);
+    if (match) {
+        return [item.content.substring(0, match.index).trim(), true];
+    }
+    const content = item.content.replace(/\s\s/g, " ");
+    const truncated = truncate(content, configuration.truncate > 0 ? configuration.truncate : 250);
+    return [truncated, truncated !== content];
+};
+
+const permalink = (folder, item) => {
+    const slug = item.slug || folder.replace(/^(\d{4})-(\d{2})-(\d{2})(-|$)/, "") || folder;
+    const date = (item.date || "").match(/^(\d{4})-(\d{2})-(\d{2})/) || ["", "", "", ""];
+    const values = { ":folder": folder, ":slug": slug, ":year": date[1], ":month": date[2], ":day": date[3] };
+    const pattern = configuration.permalink || "/blog/:folder/";
+    const location = path.posix.normalize(`/${pattern.replace(/:folder|:slug|:year|:month|:day/g, (key) => values[key])}`).replace(/^\/+|\/+$/g, "");
+    return location ? `${location}/` : "";
+};
+
+const escapeAttribute = (text) => {
+    const map = { "&": "&amp;", "'": "&#39;", "<": "&lt;", ">": "&gt;", '"': "&#34;" };
+    return text.replace(/[&'<>"]/g, (char) => map[char]);
+};
+
+const seo = (item, url, published, modified) => {
+    const title = item.title || "";
+    const description = item.description || "";
+    let image = item.image || "";
+    if (!image) {
+        const match = item.content.match(/<img[^>]*\ssrc="([^"]*)"/);
+        if (match) {
+            image = unescapeHtml(match[1]);
+        }
+    }
+    if (image && !/^([a-zA-Z][-+.a-zA-Z0-9]*:|\/\/)/.test(image)) {
+        image = image.startsWith("/") ? (configuration.host || "") + image : url + image;
+    }
+    const lines = url ? [`<link rel="canonical" href="${escapeAttribute(url)}" />`] : [];
+    const meta = (attribute, name, content) => {
+        if (content) {
+            lines.push(`<meta ${attribute}="${name}" content="${escapeAttribute(content)}" />`);
+        }
+    };
+    const schema = {
+        "@context": "https://schema.org",
+        "@type": "BlogPosting",
+        "headline": title,
+        "description": description,
+        "author": { "@type": "Person", "name": item.author || "" }
+    };
+    if (url) {
+        schema.url = url;
+        schema.mainEntityOfPage = url;
+    }
+    meta("property", "og:type", "article");
+    meta("property", "og:site_name", configuration.name);
+    meta("property", "og:title", title);
+    meta("property", "og:description", description);
+    meta("property", "og:url", url);
+    meta("property", "og:image", image);
+    if (published && !isNaN(new Date(published))) {
+        schema.datePublished = formatDate(new Date(published), "atom");
+        schema.dateModified = schema.datePublished;
+        meta("property", "article:published_time", schema.datePublished);
+    }
+    if (modified && !isNaN(new Date(modified))) {
+        schema.dateModified = formatDate(new Date(modified), "atom");
+        meta("property", "article:modified_time", schema.dateModified);
+    }
+    if (image) {
+        schema.image = image;
+        meta("name", "twitter:card", "summary_large_image");
+    } else {
+        meta("name", "twitter:card", "summary");
+    }
+    meta("name", "twitter:title", title);
+    meta("name", "twitter:description", description);
+    meta("name", "twitter:image", image);
+    const sorted = {};
+    for (const key of Object.keys(schema).sort()) {
+        sorted[key] = schema[key];
+    }
+    const json = JSON.stringify(sorted).replace(/[<>&\u2028\u2029]/g, (char) => `\\u${char.charCodeAt(0).toString(16).padStart(4, "0")}`);
+    lines.push(`<script type="application/ld+json">${json}</script>`);
+    return lines.join("\n");
+};
+
 const posts = () => {
     const files = fs.readdirSync("content/blog/");
     return files.filter((post) => fs.statSync(`content/blog/${post}`).isDirectory() && fs.existsSync(`content/blog/${post}/index.md`)).sort().reverse();
@@ -268,15 +379,12 @@ const renderBlog = (folders, destination, root, page) => {
         const folder = folders.shift();
         const item = loadPost(`content/blog/${folder}/index.md`);
         if (item && (item.state === "post" || environment !== "production")) {
-            item.url = `blog/${folder}/`;
+            item.url = permalink(folder, item);
             if ("date" in item) {
                 const date = new Date(`${item.date.split(/ \+| -/)[0]}Z`);
                 item.date = formatDate(date, "user");
             }
-            const content = item.content.replace(/\s\s/g, " ");
-            const truncated = truncate(content, 250);
-            item.content = truncated;
-            item.more = truncated !== content;
+            [item.content, item.more] = excerpt(item);
             view.items.push(item);
             count--;
         }
@@ -314,7 +422,7 @@ const renderFeed = (source, destination) => {
         const folder = folders.shift();
         const item = loadPost(`content/blog/${folder}/index.md`);
         if (item && (item.state === "post" || environment !== "production")) {
-            item.url = `${host}/blog/${folder}/`;
+            item.url = `${host}/${permalink(folder, item)}`;
             if (!item.author || item.author === configuration.name) {
                 item.author = false;
             }
@@ -346,6 +454,9 @@ const renderPost = (source, destination, root) => {
     if (source.startsWith("content/blog/") && source.endsWith("/index.md")) {
         const item = loadPost(source);
         if (item) {
+            const location = permalink(path.basename(path.dirname(source)), item);
+            const published = item.date || "";
+            const modified = item.updated || "";
             if (item.updated && item.updated !== item.date) {
                 const date = new Date(`${item.updated.split(/ \+| -/)[0]}Z`);
                 item.updated = formatDate(date, "user");
@@ -357,6 +468,13 @@ const renderPost = (source, destination, root) => {
                 item.date = formatDate(date, "user");
             }
             item.author = item.author || configuration.name;
+            if (!item.description) {
+                item.description = plainText(excerpt(item)[0]);
+            }
+            if (configuration.host) {
+                item.canonical = `${configuration.host}/${location}`;
+            }
+            item.seo = seo(item, item.canonical || "", published, modified);
             const view = merge(configuration, item);
             view.root = root;
             const template = fs.readFileSync(`themes/${theme}/post.html`, "utf-8");
@@ -445,6 +563,63 @@ const render = (source, destination, root) => {
     }
 };
 
+const list = (value) => {
+    if (Array.isArray(value)) {
+        return value;
+    }
+    return (value || "").replace(/^[[\]]+|[[\]]+$/g, "").split(/[, ]/).filter((item) => item.length > 0);
+};
+
+const renderRedirects = () => {
+    const lines = [];
+    if (fs.existsSync("redirect.map")) {
+        for (const line of fs.readFileSync("redirect.map", "utf-8").split(/\r\n?|\n/)) {
+            if (line.trim().length > 0) {
+                lines.push(line);
+            }
+        }
+    }
+    for (const folder of posts()) {
+        const item = loadPost(`content/blog/${folder}/index.md`);
+        if (item && (item.state === "post" || environment !== "production")) {
+            const location = permalink(folder, item);
+            for (let alias of list(item.aliases)) {
+                alias = `/${alias.replace(/^\//, "")}`;
+                lines.push(`${alias.padEnd(14)} ${`/${location}`.padEnd(15)} 301`);
+                let file = alias.replace(/^\//, "");
+                if (alias.endsWith("/") || path.extname(alias) === "") {
+                    file = path.posix.join(file, "index.html");
+                }
+                const root = "../".repeat(file.split("/").length - 1);
+                file = path.posix.join(destination, file);
+                if (fs.existsSync(file)) {
+                    console.log(`Alias '${alias}' conflicts with '${file}'.`);
+                    continue;
+                }
+                const url = escapeAttribute(root + location);
+                const canonical = configuration.host ? `<link rel="canonical" href="${escapeAttribute(`${configuration.host}/${location}`)}" />\n` : "";
+                makeDirectory(path.dirname(file));
+                fs.writeFileSync(file, `<!DOCTYPE html>
+<html>
+<head>
+<title>Redirect</title>
+${canonical}<meta name="robots" content="noindex" />
+<meta http-equiv="refresh" content="0; url=${url}" />
+</head>
+<body>
+<a href="${url}">${url}</a>
+</body>
+</html>`);
+            }
+        }
+    }
+    const data = `${lines.join("\n")}\n`;
+    for (const name of ["redirect.map", "_redirects"]) {
+        console.log(`${destination}/${name}`);
+        fs.writeFileSync(`${destination}/${name}`, data);
+    }
+};
+
 const makeDirectory = (directory) =>{
     directory.split("/").reduce((current, folder) => {
         current += `${folder}/`;
@@ -460,7 +635,11 @@ const renderDirectory = (source, destination, root) => {
     const items = fs.readdirSync(source);
     for (const item of items) {
         if (!item.startsWith(".")) {
-            if (fs.statSync(source + item).isDirectory()) {
+            const post = source === "content/blog/" ? loadPost(`${source}${item}/index.md`) : null;
+            if (post) {
+                const location = permalink(item, post);
+                renderDirectory(`${source}${item}/`, path.posix.join(destination, root, location, "/"), "../".repeat(location.split("/").length - 1));
+            } else if (fs.statSync(source + item).isDirectory()) {
                 renderDirectory(`${source}${item}/`, `${destination}${item}/`, `${root}../`);
             } else {
                 const dest = item.endsWith('.md') ? destination + item.replace(/\.md$/, '.html') : destination + item;
@@ -486,3 +665,4 @@ const cleanDirectory = (directory) => {
 
 cleanDirectory(destination);
 renderDirectory("content/", `${destination}/`, "");
+renderRedirects();
@@ -2,6 +2,7 @@
 
 import codecs
 import datetime
+import html
 import json
 import os
 import platform
@@ -220,18 +221,24 @@ def load_post(path):
         item = {}
         content = []
         metadata = -1
+        name = ""
         lines = re.split(r"\r\n?|\n", data)
         while len(lines) > 0:
             line = lines.pop(0)
             if line.startswith("---"):
                 metadata += 1
             elif metadata == 0:
+                trimmed = line.strip()
                 index = line.find(":")
-                if index >= 0:
+                if isinstance(item.get(name), list) and trimmed.startswith("- "):
+                    item[name].append(trimmed[2:].strip().strip('"'))
+                elif index >= 0:
                     name = line[0:index].strip()
                     value = line[index+1:].strip()
                     if value.startswith('"') and value.endswith('"'):
                         value = value[1:-1]
+                    if value == "" and len(lines) > 0 and lines[0].strip().startswith("- "):
+                        value = []
                     item[name] = value
             else:
                 content.append(line)
@@ -242,6 +249,93 @@ def load_post(path):
         return item
     return None
 
+def plain_text(text):
+    return " ".join(html.unescape(re.sub(r"<[^>]*>", " ", text)).split())
+
+def excerpt(item):
+    if item.get("summary"):
+        return markdown(item["summary"]), True
+    match = re.search(r"<!--\s*more\s*-->", item["content"])
+    if match:
+        return item["content"][:match.start()].strip(), True
+    length = configuration.get("truncate", 0)
+    content = re.sub(r"\s\s", " ", item["content"])
+    truncated = truncate(content, int(length) if length and length > 0 else 250)
+    return truncated, truncated != content
+
+def permalink(folder, item):
+    slug = item.get("slug") or re.sub(r"^(\d{4})-(\d{2})-(\d{2})(-|$)", "", folder) or folder
+    match = re.match(r"^(\d{4})-(\d{2})-(\d{2})", item.get("date", ""))
+    date = match.groups() if match else ("", "", "")
+    values = { ":folder": folder, ":slug": slug, ":year": date[0], ":month": date[1], ":day": date[2] }
+    pattern = configuration.get("permalink") or "/blog/:folder/"
+    location = re.sub(r":folder|:slug|:year|:month|:day", lambda match: values[match.group(0)], pattern)
+    location = os.path.normpath("/" + location).strip("/")
+    return location + "/" if location else ""
+
+def escape_attribute(text):
+    attribute_map = { "&": "&amp;", "'": "&#39;", "<": "&lt;", ">": "&gt;", '"': "&#34;" }
+    return "".join(attribute_map.get(c, c) for c in text)
+
+def parse_date(value):
+    try:
+        return dateutil.parser.parse(value)
+    except (ValueError, OverflowError):
+        return None
+
+def seo(item, url, published, modified):
+    title = item.get("title", "")
+    description = item.get("description", "")
+    image = item.get("image", "")
+    if not image:
+        match = re.search(r"<img[^>]*\ssrc=\"([^\"]*)\"", item["content"])
+        if match:
+            image = html.unescape(match.group(1))
+    if image and not re.match(r"^([a-zA-Z][-+.a-zA-Z0-9]*:|//)", image):
+        image = configuration.get("host", "") + image if image.startswith("/") else url + image
+    lines = [f'<link rel="canonical" href="{escape_attribute(url)}" />'] if url else []
+    def meta(attribute, name, content):
+        if content:
+            lines.append(f'<meta {attribute}="{name}" content="{escape_attribute(content)}" />')
+    schema = {
+        "@context": "https://schema.org",
+        "@type": "BlogPosting",
+        "headline": title,
+        "description": description,
+        "author": { "@type": "Person", "name": item.get("author", "") }
+    }
+    if url:
+        schema["url"] = url
+        schema["mainEntityOfPage"] = url
+    meta("property", "og:type", "article")
+    meta("property", "og:site_name", configuration["name"])
+    meta("property", "og:title", title)
+    meta("property", "og:description", description)
+    meta("property", "og:url", url)
+    meta("property", "og:image", image)
+    date = parse_date(published) if published else None
+    if date:
+        schema["datePublished"] = format_date(date, "atom")
+        schema["dateModified"] = schema["datePublished"]
+        meta("property", "article:published_time", schema["datePublished"])
+    date = parse_date(modified) if modified else None
+    if date:
+        schema["dateModified"] = format_date(date, "atom")
+        meta("property", "article:modified_time", schema["dateModified"])
+    if image:
+        schema["image"] = image
+        meta("name", "twitter:card", "summary_large_image")
+    else:
+        meta("name", "twitter:card", "summary")
+    meta("name", "twitter:title", title)
+    meta("name", "twitter:description", description)
+    meta("name", "twitter:image", image)
+    data = json.dumps(schema, sort_keys=True, separators=(",", ":"), ensure_ascii=False)
+    for c in "<>&\u2028\u2029":
+        data = data.replace(c, f"\\u{ord(c):04x}")
+    lines.append(f'<script type="application/ld+json">{data}</script>')
+    return "\n".join(lines)
+
 def render_blog(folders, desitination, root, page):
     view = { "items": [] }
     count = 10
@@ -249,15 +343,11 @@ def render_blog(folders, desitination, root, page):
         folder = folders.pop(0)
         item = load_post("content/blog/" + folder + "/index.md")
         if item and (item["state"] == "post" or environment != "production"):
-            item["url"] = f"blog/{folder}/"
+            item["url"] = permalink(folder, item)
             if "date" in item:
                 date = dateutil.parser.parse(item["date"])
                 item["date"] = format_date(date, "user")
-            content = item["content"]
-            content = re.sub(r"\s\s", " ", content)
-            truncated = truncate(content, 250)
-            item["content"] = truncated
-            item["more"] = truncated != content
+            item["content"], item["more"] = excerpt(item)
             view["items"].append(item)
             count -= 1
     view["placeholder"] = []
@@ -276,8 +366,16 @@ def render_post(source, destination, root):
     if source.startswith("content/blog/") and (source.endswith("/index.html") or source.endswith("/index.md")):
         item = load_post(source)
         if item:
+            location = permalink(os.path.basename(os.path.dirname(source)), item)
+            published = item.get("date", "")
+            modified = item.get("updated", "")
             if "author" not in item:
                 item["author"] = configuration["name"]
+            if "description" not in item:
+                item["description"] = plain_text(excerpt(item)[0])
+            if configuration.get("host"):
+                item["canonical"] = f"{configuration['host']}/{location}"
+            item["seo"] = seo(item, item.get("canonical", ""), published, modified)
             if "updated" in item:
                 if item["updated"] == item["date"]:
                     del item["updated"]
@@ -319,7 +417,7 @@ def render_feed(source, destination):
         folder = folders.pop(0)
         item = load_post("content/blog/" + folder + "/index.md")
         if item and (item["state"] == "post" or environment != "production"):
-            item["url"] = host + "/blog/" + folder + "/"
+            item["url"] = host + "/" + permalink(folder, item)
             if "author" not in item or item["author"] == configuration["name"]:
                 item["author"] = False
             if "date" in item:
@@ -407,11 +505,62 @@ def render_directory(source, destination, root):
     for item in os.listdir(source):
         if not item.startswith("."):
             location = f"{source}{item}"
-            if os.path.isdir(location):
+            post = load_post(f"{location}/index.md") if source == "content/blog/" else None
+            if post:
+                target = permalink(item, post)
+                render_directory(f"{location}/", os.path.normpath(os.path.join(destination, root, target)) + "/", "../" * target.count("/"))
+            elif os.path.isdir(location):
                 render_directory(f"{location}/", f"{destination}{item}/", f"{root}../")
             else:
                 render(location, f"{destination}{item}", root)
 
+def to_list(value):
+    if isinstance(value, list):
+        return value
+    return [item for item in re.split(r"[, ]", (value or "").strip("[]")) if item]
+
+def render_redirects():
+    lines = []
+    if os.path.exists("redirect.map"):
+        for line in re.split(r"\r\n?|\n", read_file("redirect.map")):
+            if line.strip():
+                lines.append(line)
+    for folder in posts():
+        item = load_post("content/blog/" + folder + "/index.md")
+        if item and (item.get("state") == "post" or environment != "production"):
+            location = permalink(folder, item)
+            for alias in to_list(item.get("aliases")):
+                alias = "/" + alias.removeprefix("/")
+                lines.append(f"{alias:<14} {'/' + location:<15} 301")
+                file = alias.removeprefix("/")
+                if alias.endswith("/") or os.path.splitext(alias)[1] == "":
+                    file = os.path.join(file, "index.html")
+                root = "../" * file.count("/")
+                file = os.path.join(destination, file)
+                if os.path.exists(file):
+                    print(f"Alias '{alias}' conflicts with '{file}'.")
+                    continue
+                url = escape_attribute(root + location)
+                canonical = ""
+                if configuration.get("host"):
+                    canonical = escape_attribute(f"{configuration['host']}/{location}")
+                    canonical = f'<link rel="canonical" href="{canonical}" />\n'
+                write_file(file, f"""<!DOCTYPE html>
+<html>
+<head>
+<title>Redirect</title>
+{canonical}<meta name="robots" content="noindex" />
+<meta http-equiv="refresh" content="0; url={url}" />
+</head>
+<body>
+<a href="{url}">{url}</a>
+</body>
+</html>""")
+    data = "\n".join(lines) + "\n"
+    for name in ["redirect.map", "_redirects"]:
+        print(f"{destination}/{name}")
+        write_file(f"{destination}/{name}", data)
+
 def clean_directory(directory):
     if os.path.exists(directory) and os.path.isdir(directory):
         for item in os.listdir(directory):
@@ -436,3 +585,4 @@ while len(args) > 0:
         destination = arg
 clean_directory(destination)
 render_directory("content/", destination + "/", "")
+render_redirects()